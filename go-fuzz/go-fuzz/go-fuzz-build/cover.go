@@ -33,13 +33,15 @@ func instrument(pkg, shortName, fullName string, fset *token.FileSet, parsedFile
 	}
 	file.addImport("go-fuzz-dep", fuzzdepPkg, "Main")
 
-	if lits != nil {
-		ast.Walk(&LiteralCollector{lits}, file.astFile)
+	if instrumentCover(pkg, shortName) {
+		if lits != nil {
+			ast.Walk(&LiteralCollector{lits}, file.astFile)
+		}
+		ast.Walk(file, file.astFile)
 	}
 
-	ast.Walk(file, file.astFile)
-
-	if sonar != nil {
+	compare := instrumentSonar(pkg, shortName)
+	if sonar != nil && compare {
 		s := &Sonar{
 			fset:      fset,
 			shortName: shortName,
@@ -47,6 +49,20 @@ func instrument(pkg, shortName, fullName string, fset *token.FileSet, parsedFile
 			pkg:       pkg,
 			blocks:    sonar,
 			info:      info,
+			fn:        "Sonar",
+		}
+		ast.Walk(s, file.astFile)
+	} else if *flagValueProfile && compare {
+		// In value profile mode comparisons in the coverage binary
+		// feed value profile table. Such sites are not reported in metadata.
+		s := &Sonar{
+			fset:      fset,
+			shortName: shortName,
+			fullName:  fullName,
+			pkg:       pkg,
+			blocks:    new([]CoverBlock),
+			info:      info,
+			fn:        "ValueProfile",
 		}
 		ast.Walk(s, file.astFile)
 	}
@@ -61,16 +77,41 @@ type Sonar struct {
 	pkg       string
 	blocks    *[]CoverBlock
 	info      *types.Info
+	fn        string // go-fuzz-dep function that is called for comparisons
 }
 
 var sonarSeq = 0
 
 func (s *Sonar) Visit(n ast.Node) ast.Visitor {
-	// TODO: detect "x&mask==0", emit sonar(x, x&^mask)
 	switch nn := n.(type) {
 	case *ast.BinaryExpr:
+		if s.instrumentMask(nn) {
+			return nil
+		}
 		break
 
+	case *ast.CallExpr:
+		s.instrumentCall(nn)
+		return nil
+
+	case *ast.IndexExpr:
+		s.instrumentMapIndex(nn)
+		return nil
+
+	case *ast.AssignStmt:
+		// Map index expressions on the left side are not lookups.
+		for _, lhs := range nn.Lhs {
+			s.walkLhs(lhs)
+		}
+		for _, rhs := range nn.Rhs {
+			ast.Walk(s, rhs)
+		}
+		return nil
+
+	case *ast.IncDecStmt:
+		s.walkLhs(nn.X)
+		return nil
+
 	case *ast.GenDecl:
 		if nn.Tok != token.VAR {
 			return nil // constants and types are not interesting
@@ -166,19 +207,6 @@ func (s *Sonar) Visit(n ast.Node) ast.Visitor {
 		return s // recurse
 	}
 
-	// TODO: handle map index expressions (especially useful for strings).
-	// E.g. when code matches a read in identifier against a set of known identifiers.
-	// For the record, it looks as follows. However, it is tricky to distinguish
-	// from slice/array index and map assignments...
-	//.  .  .  .  .  .  .  *ast.IndexExpr {
-	//.  .  .  .  .  .  .  .  X: *ast.Ident {
-	//.  .  .  .  .  .  .  .  .  Name: "m"
-	//.  .  .  .  .  .  .  .  }
-	//.  .  .  .  .  .  .  .  Index: *ast.Ident {
-	//.  .  .  .  .  .  .  .  .  Name: "s"
-	//.  .  .  .  .  .  .  .  }
-	//.  .  .  .  .  .  .  }
-
 	// TODO: transform expressions so that lhs expression contains a variable
 	// and rhs contains all constant operands. For example, for (real code from vp8 codec):
 	//	cf := (b[0]>>4)&7 == 5
@@ -195,8 +223,6 @@ func (s *Sonar) Visit(n ast.Node) ast.Visitor {
 	// we would like to emit:
 	//	Sonar(x, 100*3, SonarEQL)
 
-	// TODO: intercept strings.Index/HasPrefix and similar functions.
-
 	nn := n.(*ast.BinaryExpr)
 	var flags uint8
 	switch nn.Op {
@@ -278,11 +304,7 @@ func (s *Sonar) Visit(n ast.Node) ast.Visitor {
 	if flags&SonarConst1 != 0 && flags&SonarConst2 != 0 {
 		return nil
 	}
-	id := int(flags) | sonarSeq<<8
-	startPos := s.fset.Position(nn.Pos())
-	endPos := s.fset.Position(nn.End())
-	*s.blocks = append(*s.blocks, CoverBlock{sonarSeq, s.fullName, startPos.Line, startPos.Column, endPos.Line, endPos.Column, int(flags)})
-	sonarSeq++
+	id := s.newSite(nn, flags)
 	block := &ast.BlockStmt{}
 
 	typstr := tv.Type.String()
@@ -328,8 +350,8 @@ func (s *Sonar) Visit(n ast.Node) ast.Visitor {
 	block.List = append(block.List,
 		&ast.ExprStmt{
 			X: &ast.CallExpr{
-				Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: fuzzdepPkg}, Sel: &ast.Ident{Name: "Sonar"}},
-				Args: []ast.Expr{v1, v2, &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(id)}},
+				Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: fuzzdepPkg}, Sel: &ast.Ident{Name: s.fn}},
+				Args: []ast.Expr{v1, v2, intLit(id)},
 			},
 		},
 		&ast.ReturnStmt{Results: []ast.Expr{&ast.BinaryExpr{Op: nn.Op, X: v1, Y: v2}}},
@@ -345,6 +367,246 @@ func (s *Sonar) Visit(n ast.Node) ast.Visitor {
 	return nil
 }
 
+// newSite registers a new comparison site and returns its id for the sonar hook.
+func (s *Sonar) newSite(n ast.Node, flags uint8) int {
+	id := int(flags) | sonarSeq<<8
+	startPos := s.fset.Position(n.Pos())
+	endPos := s.fset.Position(n.End())
+	*s.blocks = append(*s.blocks, CoverBlock{sonarSeq, s.fullName, startPos.Line, startPos.Column, endPos.Line, endPos.Column, int(flags)})
+	sonarSeq++
+	return id
+}
+
+// sonarCalls lists functions that compare their two arguments,
+// the value is the part of the first argument that is compared with the second one.
+var sonarCalls = map[string]int{
+	"Equal":      SonarMatchEqual,
+	"EqualFold":  SonarMatchEqual,
+	"Compare":    SonarMatchEqual,
+	"HasPrefix":  SonarMatchPrefix,
+	"TrimPrefix": SonarMatchPrefix,
+	"Contains":   SonarMatchPrefix,
+	"Index":      SonarMatchPrefix,
+	"LastIndex":  SonarMatchPrefix,
+	"HasSuffix":  SonarMatchSuffix,
+	"TrimSuffix": SonarMatchSuffix,
+}
+
+// instrumentCall intercepts calls of bytes/strings functions that compare strings.
+// Replace:
+//
+//	strings.HasPrefix(x, y)
+//
+// with:
+//
+//	strings.HasPrefix(go-fuzz-dep.SonarStrings(x, y, id, SonarMatchPrefix))
+func (s *Sonar) instrumentCall(call *ast.CallExpr) {
+	ast.Walk(s, call.Fun)
+	for _, arg := range call.Args {
+		ast.Walk(s, arg)
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || len(call.Args) != 2 || call.Ellipsis.IsValid() {
+		return
+	}
+	fn, ok := s.info.Uses[sel.Sel].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Type().(*types.Signature).Recv() != nil {
+		return
+	}
+	match, ok := sonarCalls[fn.Name()]
+	if !ok {
+		return
+	}
+	var hook string
+	switch fn.Pkg().Path() {
+	case "bytes":
+		hook = s.fn + "Bytes"
+	case "strings":
+		hook = s.fn + "Strings"
+	default:
+		return
+	}
+	var flags uint8 = SonarEQL
+	if isConstExpr(s.info, call.Args[0]) {
+		flags |= SonarConst1
+	}
+	if isConstExpr(s.info, call.Args[1]) {
+		flags |= SonarConst2
+	}
+	if flags&SonarConst1 != 0 && flags&SonarConst2 != 0 {
+		return
+	}
+	id := s.newSite(call, flags)
+	call.Args = []ast.Expr{&ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: fuzzdepPkg}, Sel: &ast.Ident{Name: hook}},
+		Args: []ast.Expr{call.Args[0], call.Args[1], intLit(id), intLit(match)},
+	}}
+}
+
+// instrumentMapIndex intercepts map lookups with string and integer keys,
+// this catches code that matches input against a set of known values.
+// Replace:
+//
+//	m[k]
+//
+// with:
+//
+//	m[func() K { v1 := k; for v2 := range m { go-fuzz-dep.Sonar(v1, v2, id) }; return v1 }()]
+//
+// Only a few keys are compared on every lookup, the iteration order is random.
+func (s *Sonar) instrumentMapIndex(idx *ast.IndexExpr) {
+	ast.Walk(s, idx.X)
+	ast.Walk(s, idx.Index)
+	if s.fn != "Sonar" {
+		return // too expensive for value profile, which is collected on every execution
+	}
+	if !isFieldChain(idx.X) {
+		return // map expression is evaluated twice, it must not have side effects
+	}
+	m, ok := s.info.Types[idx.X].Type.Underlying().(*types.Map)
+	if !ok || isConstExpr(s.info, idx.Index) {
+		return
+	}
+	key, ok := m.Key().(*types.Basic)
+	if !ok || key.Info()&(types.IsString|types.IsInteger) == 0 {
+		return
+	}
+	const maxKeys = 16
+	id := s.newSite(idx, SonarEQL)
+	v1 := ast.NewIdent("__go_fuzz_v1")
+	v2 := ast.NewIdent("__go_fuzz_v2")
+	n := ast.NewIdent("__go_fuzz_n")
+	body := []ast.Stmt{
+		&ast.AssignStmt{Tok: token.DEFINE, Lhs: []ast.Expr{v1}, Rhs: []ast.Expr{idx.Index}},
+		&ast.AssignStmt{Tok: token.DEFINE, Lhs: []ast.Expr{n}, Rhs: []ast.Expr{intLit(0)}},
+		&ast.RangeStmt{
+			Key: v2,
+			Tok: token.DEFINE,
+			X:   idx.X,
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				&ast.ExprStmt{X: &ast.CallExpr{
+					Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: fuzzdepPkg}, Sel: &ast.Ident{Name: s.fn}},
+					Args: []ast.Expr{v1, v2, intLit(id)},
+				}},
+				&ast.IncDecStmt{X: n, Tok: token.INC},
+				&ast.IfStmt{
+					Cond: &ast.BinaryExpr{X: n, Op: token.EQL, Y: intLit(maxKeys)},
+					Body: &ast.BlockStmt{List: []ast.Stmt{&ast.BranchStmt{Tok: token.BREAK}}},
+				},
+			}},
+		},
+		&ast.ReturnStmt{Results: []ast.Expr{v1}},
+	}
+	idx.Index = &ast.CallExpr{
+		Fun: &ast.FuncLit{
+			Type: &ast.FuncType{Results: &ast.FieldList{List: []*ast.Field{{Type: ast.NewIdent(key.Name())}}}},
+			Body: &ast.BlockStmt{List: body},
+		},
+	}
+}
+
+// isFieldChain returns true if e is an identifier or a chain of field selections
+// on an identifier (x, x.m, pkg.x.m), such expressions can be evaluated twice.
+func isFieldChain(e ast.Expr) bool {
+	for {
+		switch x := e.(type) {
+		case *ast.Ident:
+			return true
+		case *ast.SelectorExpr:
+			e = x.X
+		default:
+			return false
+		}
+	}
+}
+
+// walkLhs walks left side of an assignment skipping map index expression itself.
+func (s *Sonar) walkLhs(lhs ast.Expr) {
+	if idx, ok := lhs.(*ast.IndexExpr); ok {
+		ast.Walk(s, idx.X)
+		ast.Walk(s, idx.Index)
+		return
+	}
+	ast.Walk(s, lhs)
+}
+
+// instrumentMask handles bit tests with a constant mask.
+// Replace:
+//
+//	x&mask == c
+//
+// with:
+//
+//	func() bool { v1 := x; go-fuzz-dep.Sonar(v1, v1&^mask|c, id); return v1&mask == c }() == true
+//
+// v1&^mask|c is the value that x needs to have to satisfy the condition.
+func (s *Sonar) instrumentMask(nn *ast.BinaryExpr) bool {
+	var flags uint8
+	switch nn.Op {
+	case token.EQL:
+		flags = SonarEQL
+	case token.NEQ:
+		flags = SonarNEQ
+	default:
+		return false
+	}
+	and, c := nn.X, nn.Y
+	if isConstExpr(s.info, and) {
+		and, c = c, and
+	}
+	bex, ok := and.(*ast.BinaryExpr)
+	if !ok || bex.Op != token.AND || !isConstExpr(s.info, c) {
+		return false
+	}
+	x, mask := bex.X, bex.Y
+	if isConstExpr(s.info, x) {
+		x, mask = mask, x
+	}
+	if isConstExpr(s.info, x) || !isConstExpr(s.info, mask) {
+		return false
+	}
+	basic, ok := s.info.Types[x].Type.Underlying().(*types.Basic)
+	if !ok || basic.Info()&types.IsInteger == 0 {
+		return false
+	}
+	ast.Walk(s, x)
+	id := s.newSite(nn, flags|SonarConst2)
+	v1 := ast.NewIdent("__go_fuzz_v1")
+	paren := func(e ast.Expr) ast.Expr { return &ast.ParenExpr{X: e} }
+	// Operands are converted to the basic type, because sonar does not understand named types.
+	conv := func(e ast.Expr) ast.Expr { return &ast.CallExpr{Fun: ast.NewIdent(basic.Name()), Args: []ast.Expr{e}} }
+	want := &ast.BinaryExpr{
+		X:  &ast.BinaryExpr{X: v1, Op: token.AND_NOT, Y: paren(mask)},
+		Op: token.OR,
+		Y:  paren(c),
+	}
+	body := []ast.Stmt{
+		&ast.AssignStmt{Tok: token.DEFINE, Lhs: []ast.Expr{v1}, Rhs: []ast.Expr{x}},
+		&ast.ExprStmt{X: &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: fuzzdepPkg}, Sel: &ast.Ident{Name: s.fn}},
+			Args: []ast.Expr{conv(v1), conv(want), intLit(id)},
+		}},
+		&ast.ReturnStmt{Results: []ast.Expr{&ast.BinaryExpr{
+			X:  &ast.BinaryExpr{X: v1, Op: token.AND, Y: paren(mask)},
+			Op: nn.Op,
+			Y:  paren(c),
+		}}},
+	}
+	nn.X = &ast.CallExpr{
+		Fun: &ast.FuncLit{
+			Type: &ast.FuncType{Results: &ast.FieldList{List: []*ast.Field{{Type: &ast.Ident{Name: "bool"}}}}},
+			Body: &ast.BlockStmt{List: body},
+		},
+	}
+	nn.Y = &ast.BasicLit{Kind: token.INT, Value: "true"}
+	nn.Op = token.EQL
+	return true
+}
+
+func intLit(v int) *ast.BasicLit {
+	return &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(v)}
+}
+
 func isWeirdShift(info *types.Info, n ast.Expr) bool {
 	w := &WeirdShiftWalker{info: info}
 	ast.Walk(w, n)
@@ -453,7 +715,9 @@ func trimComments(file *ast.File, fset *token.FileSet) []*ast.CommentGroup {
 	for _, group := range file.Comments {
 		var list []*ast.Comment
 		for _, comment := range group.List {
-			if strings.HasPrefix(comment.Text, "//go:") && fset.Position(comment.Slash).Column == 1 {
+			// Build constraints are retained by initialComments.
+			if strings.HasPrefix(comment.Text, "//go:") && !strings.HasPrefix(comment.Text, "//go:build") &&
+				fset.Position(comment.Slash).Column == 1 {
 				list = append(list, comment)
 			}
 		}
@@ -811,7 +1075,8 @@ func genCounter() int {
 	id := counterGen
 	buf := []byte{byte(id), byte(id >> 8), byte(id >> 16), byte(id >> 24)}
 	hash := sha1.Sum(buf)
-	return int(uint16(hash[0]) | uint16(hash[1])<<8)
+	v := uint32(hash[0]) | uint32(hash[1])<<8 | uint32(hash[2])<<16 | uint32(hash[3])<<24
+	return int(v & uint32(*flagCoverSize-1))
 }
 
 func (f *File) newCounter(start, end token.Pos, numStmt int) ast.Stmt {
@@ -823,10 +1088,19 @@ func (f *File) newCounter(start, end token.Pos, numStmt int) ast.Stmt {
 		*f.blocks = append(*f.blocks, CoverBlock{cnt, f.fullName, s.Line, s.Column, e.Line, e.Column, numStmt})
 	}
 
-	idx := &ast.BasicLit{
+	var idx ast.Expr = &ast.BasicLit{
 		Kind:  token.INT,
 		Value: strconv.Itoa(cnt),
 	}
+	if *flagEdges {
+		idx = &ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X:   ast.NewIdent(fuzzdepPkg),
+				Sel: ast.NewIdent("Edge"),
+			},
+			Args: []ast.Expr{idx},
+		}
+	}
 	counter := &ast.IndexExpr{
 		X: &ast.SelectorExpr{
 			X:   ast.NewIdent(fuzzdepPkg),
@@ -0,0 +1,72 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// patternFlag collects comma-separated glob patterns of -include/-exclude flags.
+type patternFlag []string
+
+func (f *patternFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *patternFlag) Set(v string) error {
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if _, err := path.Match(strings.TrimSuffix(p, "/..."), ""); err != nil {
+			return err
+		}
+		*f = append(*f, p)
+	}
+	return nil
+}
+
+// instrumentCover returns true if block coverage of the file needs to be collected.
+func instrumentCover(pkg, file string) bool {
+	return matchFilter(flagInclude, flagExclude, pkg, file)
+}
+
+// instrumentSonar returns true if comparisons in the file need to be
+// instrumented for sonar and value profile.
+func instrumentSonar(pkg, file string) bool {
+	return matchFilter(flagSonarInclude, flagSonarExclude, pkg, file)
+}
+
+func matchFilter(include, exclude []string, pkg, file string) bool {
+	if len(include) != 0 && !matchAny(include, pkg, file) {
+		return false
+	}
+	return !matchAny(exclude, pkg, file)
+}
+
+func matchAny(patterns []string, pkg, file string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "/...") {
+			// Match pkg and all its parent packages against the prefix.
+			prefix := strings.TrimSuffix(p, "/...")
+			for name := pkg; name != "." && name != "/"; name = path.Dir(name) {
+				if ok, _ := path.Match(prefix, name); ok {
+					return true
+				}
+			}
+			continue
+		}
+		names := []string{pkg, pkg + "/" + file}
+		if !strings.Contains(p, "/") {
+			names = append(names, file)
+		}
+		for _, name := range names {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
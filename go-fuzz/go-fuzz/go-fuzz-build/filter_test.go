@@ -0,0 +1,76 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestMatchAny(t *testing.T) {
+	tests := []struct {
+		pattern string
+		pkg     string
+		file    string
+		match   bool
+	}{
+		// pkg/... matches the package itself and all packages below it.
+		{"github.com/foo/...", "github.com/foo", "a.go", true},
+		{"github.com/foo/...", "github.com/foo/bar/baz", "a.go", true},
+		{"github.com/foo/...", "github.com/foobar", "a.go", false},
+		{"github.com/foo/...", "github.com/bar/foo", "a.go", false},
+		{"github.com/*/...", "github.com/foo/bar", "a.go", true},
+		// Plain package patterns.
+		{"github.com/foo", "github.com/foo", "a.go", true},
+		{"github.com/foo", "github.com/foo/bar", "a.go", false},
+		{"github.com/*", "github.com/foo", "a.go", true},
+		{"github.com/*", "github.com/foo/bar", "a.go", false},
+		// Patterns without slashes match file names as well.
+		{"*.pb.go", "github.com/foo", "foo.pb.go", true},
+		{"*.pb.go", "github.com/foo", "foo.go", false},
+		{"a.go", "github.com/foo", "a.go", true},
+		{"*", "github.com/foo", "a.go", true},
+		{"foo", "github.com/foo", "a.go", false},
+		// pkg/file.go patterns match files of the package.
+		{"github.com/foo/a.go", "github.com/foo", "a.go", true},
+		{"github.com/foo/a.go", "github.com/foo", "b.go", false},
+		{"github.com/foo/a.go", "github.com/foo/a.go", "b.go", true},
+		{"github.com/foo/*_gen.go", "github.com/foo", "x_gen.go", true},
+		{"github.com/foo/*_gen.go", "github.com/foo/bar", "x_gen.go", false},
+		{"*/a.go", "foo", "a.go", true},
+	}
+	for _, test := range tests {
+		if got := matchAny([]string{test.pattern}, test.pkg, test.file); got != test.match {
+			t.Errorf("matchAny(%q, %q, %q) = %v, want %v", test.pattern, test.pkg, test.file, got, test.match)
+		}
+	}
+	if matchAny(nil, "github.com/foo", "a.go") {
+		t.Errorf("empty pattern list matches")
+	}
+	if !matchAny([]string{"github.com/bar/...", "*.pb.go"}, "github.com/foo", "a.pb.go") {
+		t.Errorf("second pattern does not match")
+	}
+}
+
+func TestMatchFilter(t *testing.T) {
+	include := []string{"github.com/foo/..."}
+	exclude := []string{"*.pb.go", "github.com/foo/internal/..."}
+	tests := []struct {
+		pkg   string
+		file  string
+		match bool
+	}{
+		{"github.com/foo", "a.go", true},
+		{"github.com/foo", "a.pb.go", false},
+		{"github.com/foo/internal/x", "a.go", false},
+		{"github.com/bar", "a.go", false},
+	}
+	for _, test := range tests {
+		if got := matchFilter(include, exclude, test.pkg, test.file); got != test.match {
+			t.Errorf("matchFilter(%q, %q) = %v, want %v", test.pkg, test.file, got, test.match)
+		}
+	}
+	if !matchFilter(nil, nil, "github.com/bar", "a.go") {
+		t.Errorf("empty filter does not match")
+	}
+}
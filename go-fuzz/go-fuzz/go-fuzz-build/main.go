@@ -10,6 +10,7 @@ import (
 	"flag"
 	"fmt"
 	"go/ast"
+	"go/build"
 	"go/parser"
 	"go/token"
 	"io/ioutil"
@@ -17,27 +18,70 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
 	"golang.org/x/tools/go/types"
 )
 
 var (
-	flagOut  = flag.String("o", "", "output file")
-	flagFunc = flag.String("func", "Fuzz", "entry function")
-	flagWork = flag.Bool("work", false, "don't remove working directory")
-
-	workdir string
-	GOROOT  string
+	flagOut          = flag.String("o", "", "output file")
+	flagFunc         = flag.String("func", "", "entry function (all Fuzz* functions in the package by default)")
+	flagWork         = flag.Bool("work", false, "don't remove working directory")
+	flagValueProfile = flag.Bool("valueprofile", false, "use closeness of comparison operands as coverage (slower, but helps with magic values and checksums)")
+	flagRace         = flag.Bool("race", false, "build an additional checked binary with race detector")
+	flagCheckedFlags = flag.String("checkedflags", "", "build an additional checked binary with these go build flags (e.g. -gcflags=all=-d=checkptr)")
+	flagCoverSize    = flag.Int("coversize", CoverSize, "size of coverage table, power of 2 (larger tables have less collisions in large programs, but make fuzzing slower)")
+	flagEdges        = flag.Bool("edges", false, "edge coverage: index coverage table by hash of the previous and the current block rather than by block ID")
+	flagTags         = flag.String("tags", "", "additional build tags (comma-separated), gofuzz tag is always set")
+	flagMod          = flag.String("mod", "", "module download mode passed to go list and go build (readonly, vendor or mod)")
+	flagDiff         diffFlag
+	flagInclude      patternFlag
+	flagExclude      patternFlag
+	flagSonarInclude patternFlag
+	flagSonarExclude patternFlag
+
+	workdir    string
+	GOROOT     string
+	fuzzFuncs  []string
+	typedFuncs map[string]bool // structure-aware fuzz functions
+	argTypes   []TypeDesc
+	funcArgs   map[string][]int
+	diffFuncs  map[string][2]string // differential fuzz functions
+	hooks      map[string]bool      // FuzzMutate/FuzzPostProcess hooks present in the package
 )
 
+func init() {
+	flag.Var(&flagDiff, "diff", "differential fuzz function name=Func1,Func2: both functions have type func([]byte) ([]byte, error) and must agree on every input (can be repeated)")
+	flag.Var(&flagInclude, "include", "comma-separated package or file globs to collect block coverage for, e.g. github.com/foo/...,*.go (all packages by default)")
+	flag.Var(&flagExclude, "exclude", "comma-separated package or file globs to not collect block coverage for, e.g. github.com/golang/protobuf/...,*.pb.go")
+	flag.Var(&flagSonarInclude, "sonar-include", "comma-separated package or file globs to instrument comparisons in for sonar (-include by default)")
+	flag.Var(&flagSonarExclude, "sonar-exclude", "comma-separated package or file globs to not instrument comparisons in for sonar (-exclude by default)")
+}
+
+// diffFlag collects values of -diff flag.
+type diffFlag []string
+
+func (f *diffFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *diffFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
 const (
 	mainPkg = "go.fuzz.main"
 )
 
-// Copies the package with all dependent packages into a temp dir,
-// instruments Go source files there and builds setting GOROOT to the temp dir.
+// Instruments Go source files of the package and all dependent packages
+// into a temp dir and builds with -overlay that substitutes the instrumented
+// files for the original ones. Packages are resolved with go list, so this works
+// both in GOPATH and module mode (including replace directives and vendoring).
 func main() {
 	flag.Parse()
 	if len(flag.Args()) != 1 || len(flag.Arg(0)) == 0 {
@@ -51,46 +95,80 @@ func main() {
 		}
 		GOROOT = strings.Trim(string(out), "\n\t ")
 	}
-	pkg := flag.Arg(0)
-	if pkg[0] == '.' {
-		failf("relative import paths are not supported, please specify full package name")
+	if v := *flagCoverSize; v < 4<<10 || v > 16<<20 || v&(v-1) != 0 {
+		failf("-coversize must be a power of 2 between 4K and 16M")
+	}
+	if flagSonarInclude == nil && flagSonarExclude == nil {
+		flagSonarInclude, flagSonarExclude = flagInclude, flagExclude
+	}
+	// Relative paths are resolved by go list.
+	pkg := goList(flag.Arg(0)).ImportPath
+
+	fuzzFuncs, typedFuncs = findFuzzFuncs(pkg)
+	hooks = findHooks(pkg)
+	diffFuncs = findDiffFuncs(pkg)
+	for name := range diffFuncs {
+		for _, f := range fuzzFuncs {
+			if f == name {
+				failf("differential fuzz function %v clashes with fuzz function %v", name, f)
+			}
+		}
+		fuzzFuncs = append(fuzzFuncs, name)
+	}
+	sort.Strings(fuzzFuncs)
+	if *flagFunc != "" {
+		found := false
+		for _, f := range fuzzFuncs {
+			if f == *flagFunc {
+				found = true
+				break
+			}
+		}
+		if !found {
+			failf("function %v is not found in package %v or has wrong signature", *flagFunc, pkg)
+		}
+		fuzzFuncs = []string{*flagFunc}
+	}
+	if len(fuzzFuncs) == 0 {
+		failf("package %v does not contain any Fuzz functions", pkg)
 	}
 
 	// To produce error messages (this is much faster and gives correct line numbers).
 	testNormalBuild(pkg)
 
 	deps := make(map[string]bool)
-	for _, p := range goListList(pkg, "Deps") {
+	for _, p := range goList(pkg).Deps {
 		deps[p] = true
 	}
 	deps[pkg] = true
-	// These packages are used by go-fuzz-dep, so we need to copy them regardless.
-	deps["runtime"] = true
-	deps["syscall"] = true
-	deps["time"] = true
-	deps["errors"] = true
-	deps["unsafe"] = true
-	deps["sync"] = true
-	deps["sync/atomic"] = true
-	if runtime.GOOS == "windows" {
-		// syscall depends on unicode/utf16.
-		// Cross-compilation is not implemented.
-		deps["unicode/utf16"] = true
-	}
 
 	lits := make(map[Literal]struct{})
 	var blocks, sonar []CoverBlock
-	sonarBin := buildInstrumentedBinary(pkg, deps, nil, nil, &sonar)
-	coverBin := buildInstrumentedBinary(pkg, deps, lits, &blocks, nil)
-	metaData := createMeta(lits, blocks, sonar)
+	sonarBin := buildInstrumentedBinary(pkg, deps, nil, nil, &sonar, nil)
+	coverBin := buildInstrumentedBinary(pkg, deps, lits, &blocks, nil, nil)
+	// The checked binary is used by go-fuzz to re-run corpus inputs
+	// with additional checks (e.g. race detector).
+	var checkedBin string
+	var checkedFlags []string
+	if *flagRace {
+		checkedFlags = append(checkedFlags, "-race")
+	}
+	checkedFlags = append(checkedFlags, strings.Fields(*flagCheckedFlags)...)
+	if len(checkedFlags) != 0 {
+		checkedBin = buildInstrumentedBinary(pkg, deps, nil, new([]CoverBlock), nil, checkedFlags)
+	}
+	metaData := createMeta(lits, blocks, sonar, strings.Join(checkedFlags, " "))
 	defer func() {
 		os.Remove(coverBin)
 		os.Remove(sonarBin)
+		if checkedBin != "" {
+			os.Remove(checkedBin)
+		}
 		os.Remove(metaData)
 	}()
 
 	if *flagOut == "" {
-		*flagOut = goListProps(pkg, "Name")[0] + "-fuzz.zip"
+		*flagOut = goList(pkg).Name + "-fuzz.zip"
 	}
 	outf, err := os.Create(*flagOut)
 	if err != nil {
@@ -108,6 +186,9 @@ func main() {
 	}
 	zipFile("cover.exe", coverBin)
 	zipFile("sonar.exe", sonarBin)
+	if checkedBin != "" {
+		zipFile("checked.exe", checkedBin)
+	}
 	zipFile("metadata", metaData)
 	if err := zipw.Close(); err != nil {
 		failf("failed to close zip file: %v", err)
@@ -131,23 +212,25 @@ func testNormalBuild(pkg string) {
 	defer func() {
 		workdir = ""
 	}()
-	copyFuzzDep(workdir)
-	createFuzzMain(pkg)
-	cmd := exec.Command("go", "build", "-tags", "gofuzz", "-o", filepath.Join(workdir, "bin"), mainPkg)
-	for _, v := range os.Environ() {
-		if strings.HasPrefix(v, "GOPATH") {
-			continue
-		}
-		cmd.Env = append(cmd.Env, v)
-	}
-	cmd.Env = append(cmd.Env, "GOPATH="+workdir+string(os.PathListSeparator)+os.Getenv("GOPATH"))
-	if out, err := cmd.CombinedOutput(); err != nil {
-		failf("failed to execute go build: %v\n%v", err, string(out))
-	}
+	overlay := make(map[string]string)
+	addFuzzDep(overlay)
+	createFuzzMain(pkg, nil, overlay)
+	goBuild(pkg, overlay, filepath.Join(workdir, "bin"), nil)
 }
 
-func createMeta(lits map[Literal]struct{}, blocks []CoverBlock, sonar []CoverBlock) string {
-	meta := MetaData{Blocks: blocks, Sonar: sonar}
+func createMeta(lits map[Literal]struct{}, blocks []CoverBlock, sonar []CoverBlock, checked string) string {
+	meta := MetaData{Blocks: blocks, Sonar: sonar, Funcs: fuzzFuncs, Types: argTypes, FuncArgs: funcArgs, Checked: checked, Edges: *flagEdges,
+		Mutate: hooks["FuzzMutate"], PostProcess: hooks["FuzzPostProcess"],
+		Filter: InstrFilter{
+			Include:      flagInclude,
+			Exclude:      flagExclude,
+			SonarInclude: flagSonarInclude,
+			SonarExclude: flagSonarExclude,
+		},
+		SourceDirs: srcDirs}
+	if *flagCoverSize != CoverSize {
+		meta.CoverSize = *flagCoverSize
+	}
 	for k := range lits {
 		meta.Literals = append(meta.Literals, k)
 	}
@@ -160,7 +243,7 @@ func createMeta(lits map[Literal]struct{}, blocks []CoverBlock, sonar []CoverBlo
 	return f
 }
 
-func buildInstrumentedBinary(pkg string, deps map[string]bool, lits map[Literal]struct{}, blocks *[]CoverBlock, sonar *[]CoverBlock) string {
+func buildInstrumentedBinary(pkg string, deps map[string]bool, lits map[Literal]struct{}, blocks *[]CoverBlock, sonar *[]CoverBlock, buildFlags []string) string {
 	var err error
 	workdir, err = ioutil.TempDir("", "go-fuzz-build")
 	if err != nil {
@@ -175,68 +258,344 @@ func buildInstrumentedBinary(pkg string, deps map[string]bool, lits map[Literal]
 		}()
 	}
 
-	if deps["runtime/cgo"] {
-		// Trick go command into thinking that it has up-to-date sources for cmd/cgo.
-		cgoDir := filepath.Join(workdir, "src", "cmd", "cgo")
-		if err := os.MkdirAll(cgoDir, 0700); err != nil {
-			failf("failed to create temp dir: %v", err)
+	overlay := make(map[string]string)
+	typed := instrumentPackages(deps, lits, blocks, sonar, overlay)
+	addFuzzDep(overlay)
+	createFuzzMain(pkg, typed[pkg], overlay)
+
+	outf := tempFile()
+	os.Remove(outf)
+	outf += ".exe"
+	goBuild(pkg, overlay, outf, buildFlags)
+	return outf
+}
+
+// goBuild builds the generated main package of pkg into out.
+// overlay maps original file names to replacement files in workdir
+// (files that don't exist, like the main package, are added).
+func goBuild(pkg string, overlay map[string]string, out string, buildFlags []string) {
+	data, err := json.Marshal(struct{ Replace map[string]string }{overlay})
+	if err != nil {
+		failf("failed to serialize overlay: %v", err)
+	}
+	overlayFile := filepath.Join(workdir, "overlay.json")
+	writeFile(overlayFile, data)
+	args := append([]string{"build"}, goFlags()...)
+	args = append(args, buildFlags...)
+	args = append(args, "-overlay", overlayFile, "-o", out, pkg+"/"+mainPkg)
+	if output, err := exec.Command("go", args...).CombinedOutput(); err != nil {
+		failf("failed to execute go build: %v\n%v", err, string(output))
+	}
+}
+
+func addFuzzDep(overlay map[string]string) {
+	// In Go1.6 standard packages can't depend on non-standard ones.
+	// So we pretend that go-fuzz-dep is a standard one
+	// by adding its files to GOROOT/src in the overlay.
+	for _, p := range []string{"go-fuzz-dep", "go-fuzz-defs"} {
+		dir := goListDir("github.com/dvyukov/go-fuzz/" + p)
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			failf("failed to scan dir '%v': %v", dir, err)
+		}
+		for _, f := range files {
+			if !f.IsDir() && isSourceFile(f.Name()) {
+				overlay[filepath.Join(GOROOT, "src", p, f.Name())] = filepath.Join(dir, f.Name())
+			}
 		}
-		src := "// +build never\npackage main\n"
-		writeFile(filepath.Join(cgoDir, "fake.go"), []byte(src))
 	}
-	copyDir(filepath.Join(GOROOT, "pkg", "tool"), filepath.Join(workdir, "pkg", "tool"), true, nil)
-	if _, err := os.Stat(filepath.Join(GOROOT, "pkg", "include")); err == nil {
-		copyDir(filepath.Join(GOROOT, "pkg", "include"), filepath.Join(workdir, "pkg", "include"), true, nil)
-	} else {
-		// Cross-compilation is not implemented.
-		copyDir(filepath.Join(GOROOT, "pkg", runtime.GOOS+"_"+runtime.GOARCH), filepath.Join(workdir, "pkg", runtime.GOOS+"_"+runtime.GOARCH), true, nil)
+	if *flagCoverSize != CoverSize {
+		src := fmt.Sprintf("package base\n\nconst CoverSize = %v\n", *flagCoverSize)
+		f := filepath.Join(workdir, "coversize.go")
+		writeFile(f, []byte(src))
+		overlay[filepath.Join(GOROOT, "src", "go-fuzz-defs", "coversize.go")] = f
 	}
-	for p := range deps {
-		clonePackage(workdir, p, p)
+}
+
+// createFuzzMain generates main package that calls the fuzz functions.
+// Wrappers for structure-aware fuzz functions are generated from type information
+// of the instrumented package. If typed is nil (normal build that is used only
+// to produce error messages), structure-aware functions are only referenced.
+func createFuzzMain(pkg string, typed *types.Package, overlay map[string]string) {
+	var gen *TypedGen
+	if typed != nil {
+		gen = newTypedGen(typed)
+		// Structure-aware functions with arguments that can't be decoded are skipped,
+		// unless the function is selected with -func. The list is filtered
+		// on the first instrumented build, so the warning is printed once.
+		var funcs []string
+		for _, f := range fuzzFuncs {
+			if typedFuncs[f] {
+				if err := gen.check(f); err != nil {
+					if *flagFunc != "" {
+						failf("%v", err)
+					}
+					fmt.Fprintf(os.Stderr, "warning: skipping fuzz function %v\n", err)
+					continue
+				}
+			}
+			funcs = append(funcs, f)
+		}
+		if len(funcs) == 0 {
+			failf("package %v does not contain any supported Fuzz functions", pkg)
+		}
+		fuzzFuncs = funcs
+	}
+	fns, imports, code := "", "", ""
+	for _, f := range fuzzFuncs {
+		switch {
+		case diffFuncs[f] != [2]string{}:
+			fns += fmt.Sprintf("\t\tdep.Diff(%[1]q, target.%[1]v, %[2]q, target.%[2]v),\n", diffFuncs[f][0], diffFuncs[f][1])
+		case !typedFuncs[f]:
+			fns += fmt.Sprintf("\t\ttarget.%v,\n", f)
+		case gen != nil:
+			fns += fmt.Sprintf("\t\t%v,\n", gen.wrapper(f))
+		default:
+			code += fmt.Sprintf("var _ = target.%v\n", f)
+		}
 	}
-	instrumentPackages(workdir, deps, lits, blocks, sonar)
-	copyFuzzDep(workdir)
-	createFuzzMain(pkg)
+	if gen != nil {
+		imports = gen.importSrc()
+		code = gen.buf.String()
+		argTypes = gen.types
+		funcArgs = gen.funcArgs
+	}
+	setHooks := ""
+	if len(hooks) != 0 {
+		hook := func(name string) string {
+			if hooks[name] {
+				return "target." + name
+			}
+			return "nil"
+		}
+		setHooks = fmt.Sprintf("\tdep.SetHooks(%v, %v)\n", hook("FuzzMutate"), hook("FuzzPostProcess"))
+	}
+	src := fmt.Sprintf(mainSrc, pkg, imports, fns, setHooks, code)
+	f := filepath.Join(workdir, "main.go")
+	writeFile(f, []byte(src))
+	// The main package is placed into a subdir of pkg, so that it is resolved
+	// in the same module (or GOPATH dir) and sees the same vendor dirs.
+	overlay[filepath.Join(goList(pkg).Dir, mainPkg, "main.go")] = f
+}
 
-	outf := tempFile()
-	os.Remove(outf)
-	outf += ".exe"
-	cmd := exec.Command("go", "build", "-tags", "gofuzz", "-o", outf, mainPkg)
-	for _, v := range os.Environ() {
-		if strings.HasPrefix(v, "GOROOT") {
-			continue
+// findFuzzFuncs returns names of all functions of the form:
+//
+//	func FuzzXxx(data []byte) int
+//
+// in the package, as well as structure-aware fuzz functions of the form:
+//
+//	func FuzzXxx(a int, s string, m MyStruct) int
+//
+// Argument types of the latter are checked when the main package is generated.
+func findFuzzFuncs(pkg string) ([]string, map[string]bool) {
+	dir := goList(pkg).Dir
+	fset := token.NewFileSet()
+	var funcs []string
+	typed := make(map[string]bool)
+	for _, fn := range goList(pkg).files() {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, fn), nil, 0)
+		if err != nil {
+			failf("failed to parse %v: %v", fn, err)
+		}
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv != nil || !isFuzzFuncName(fd.Name.Name) || !isFuzzFuncType(fd.Type) {
+				continue
+			}
+			funcs = append(funcs, fd.Name.Name)
+			if !isRawFuzzFunc(fd.Type) {
+				typed[fd.Name.Name] = true
+			}
 		}
-		cmd.Env = append(cmd.Env, v)
 	}
-	cmd.Env = append(cmd.Env, "GOROOT="+workdir)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		failf("failed to execute go build: %v\n%v", err, string(out))
+	sort.Strings(funcs)
+	return funcs, typed
+}
+
+// findDiffFuncs parses -diff flags and checks that the named functions
+// exist in the package and have the following type:
+//
+//	func Xxx(data []byte) ([]byte, error)
+func findDiffFuncs(pkg string) map[string][2]string {
+	res := make(map[string][2]string)
+	if len(flagDiff) == 0 {
+		return res
+	}
+	dir := goList(pkg).Dir
+	fset := token.NewFileSet()
+	funcs := make(map[string]bool)
+	for _, fn := range goList(pkg).files() {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, fn), nil, 0)
+		if err != nil {
+			failf("failed to parse %v: %v", fn, err)
+		}
+		for _, decl := range f.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && isDiffFuncType(fd.Type) {
+				funcs[fd.Name.Name] = true
+			}
+		}
 	}
-	return outf
+	for _, v := range flagDiff {
+		eq := strings.IndexByte(v, '=')
+		if eq <= 0 {
+			failf("bad -diff value '%v', want name=Func1,Func2", v)
+		}
+		name := v[:eq]
+		fns := strings.Split(v[eq+1:], ",")
+		if len(fns) != 2 {
+			failf("bad -diff value '%v', want name=Func1,Func2", v)
+		}
+		if _, ok := res[name]; ok {
+			failf("duplicate differential fuzz function %v", name)
+		}
+		for _, fn := range fns {
+			if !funcs[fn] {
+				failf("function %v is not found in package %v or does not have type func([]byte) ([]byte, error)", fn, pkg)
+			}
+		}
+		res[name] = [2]string{fns[0], fns[1]}
+	}
+	return res
 }
 
-func copyFuzzDep(workdir string) {
-	// In Go1.6 standard packages can't depend on non-standard ones.
-	// So we pretend that go-fuzz-dep is a standard one.
-	clonePackage(workdir, "github.com/dvyukov/go-fuzz/go-fuzz-dep", "go-fuzz-dep")
-	clonePackage(workdir, "github.com/dvyukov/go-fuzz/go-fuzz-defs", "go-fuzz-defs")
+// findHooks returns which of the optional mutation hooks are present in the package:
+//
+//	func FuzzMutate(data []byte, seed int64) []byte
+//	func FuzzPostProcess(data []byte) []byte
+//
+// FuzzMutate returns a mutated copy of data (seed is a random value to make
+// it deterministic), FuzzPostProcess fixes up a mutated input (e.g. recalculates
+// checksums and lengths). go-fuzz calls them for a fraction of inputs (-hooks flag).
+func findHooks(pkg string) map[string]bool {
+	res := make(map[string]bool)
+	dir := goList(pkg).Dir
+	fset := token.NewFileSet()
+	for _, fn := range goList(pkg).files() {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, fn), nil, 0)
+		if err != nil {
+			failf("failed to parse %v: %v", fn, err)
+		}
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv != nil {
+				continue
+			}
+			params, results := flattenFields(fd.Type.Params), flattenFields(fd.Type.Results)
+			switch fd.Name.Name {
+			case "FuzzMutate":
+				if len(params) != 2 || !isByteSlice(params[0]) || !isIdent(params[1], "int64") ||
+					len(results) != 1 || !isByteSlice(results[0]) {
+					failf("FuzzMutate must have type func(data []byte, seed int64) []byte")
+				}
+			case "FuzzPostProcess":
+				if len(params) != 1 || !isByteSlice(params[0]) || len(results) != 1 || !isByteSlice(results[0]) {
+					failf("FuzzPostProcess must have type func(data []byte) []byte")
+				}
+			default:
+				continue
+			}
+			res[fd.Name.Name] = true
+		}
+	}
+	return res
 }
 
-func createFuzzMain(pkg string) {
-	if err := os.MkdirAll(filepath.Join(workdir, "src", mainPkg), 0700); err != nil {
-		failf("failed to create temp dir: %v", err)
+// flattenFields returns types of all fields in fl (one per name).
+func flattenFields(fl *ast.FieldList) []ast.Expr {
+	if fl == nil {
+		return nil
+	}
+	var res []ast.Expr
+	for _, f := range fl.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			res = append(res, f.Type)
+		}
+	}
+	return res
+}
+
+func isByteSlice(e ast.Expr) bool {
+	arr, ok := e.(*ast.ArrayType)
+	return ok && arr.Len == nil && isIdent(arr.Elt, "byte")
+}
+
+func isIdent(e ast.Expr, name string) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+// isDiffFuncType returns true for func(data []byte) ([]byte, error).
+func isDiffFuncType(ft *ast.FuncType) bool {
+	if ft.Params == nil || len(ft.Params.List) == 0 || !isRawFuzzFunc(ft) {
+		return false
+	}
+	res := ft.Results
+	if res == nil || len(res.List) == 0 || len(res.List) > 2 {
+		return false
 	}
-	src := fmt.Sprintf(mainSrc, pkg, *flagFunc)
-	writeFile(filepath.Join(workdir, "src", mainPkg, "main.go"), []byte(src))
+	var results []ast.Expr
+	for _, f := range res.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			results = append(results, f.Type)
+		}
+	}
+	if len(results) != 2 {
+		return false
+	}
+	arr, ok := results[0].(*ast.ArrayType)
+	if !ok || arr.Len != nil {
+		return false
+	}
+	elem, ok := arr.Elt.(*ast.Ident)
+	if !ok || elem.Name != "byte" {
+		return false
+	}
+	err, ok := results[1].(*ast.Ident)
+	return ok && err.Name == "error"
 }
 
-func clonePackage(workdir, pkg, targetPkg string) {
-	dir := goListProps(pkg, "Dir")[0]
-	if !strings.HasSuffix(filepath.ToSlash(dir), pkg) {
-		failf("package dir '%v' does not end with import path '%v'", dir, pkg)
+// isFuzzFuncName is similar to isTest in cmd/go: Fuzz, FuzzFoo and Fuzz_foo are fine, Fuzzy is not.
+func isFuzzFuncName(name string) bool {
+	if !strings.HasPrefix(name, "Fuzz") {
+		return false
+	}
+	if len(name) == len("Fuzz") {
+		return true
 	}
-	newDir := filepath.Join(workdir, "src", targetPkg)
-	copyDir(dir, newDir, false, isSourceFile)
+	r, _ := utf8.DecodeRuneInString(name[len("Fuzz"):])
+	return !unicode.IsLower(r)
+}
+
+func isFuzzFuncType(ft *ast.FuncType) bool {
+	if ft.Params == nil || len(ft.Params.List) == 0 {
+		return false
+	}
+	if ft.Results == nil || len(ft.Results.List) != 1 || len(ft.Results.List[0].Names) > 1 {
+		return false
+	}
+	res, ok := ft.Results.List[0].Type.(*ast.Ident)
+	return ok && res.Name == "int"
+}
+
+// isRawFuzzFunc returns true for func(data []byte) int.
+func isRawFuzzFunc(ft *ast.FuncType) bool {
+	if len(ft.Params.List) != 1 || len(ft.Params.List[0].Names) > 1 {
+		return false
+	}
+	arr, ok := ft.Params.List[0].Type.(*ast.ArrayType)
+	if !ok || arr.Len != nil {
+		return false
+	}
+	elem, ok := arr.Elt.(*ast.Ident)
+	return ok && elem.Name == "byte"
 }
 
 type Package struct {
@@ -249,7 +608,12 @@ type Package struct {
 	deps    []*Package
 }
 
-func instrumentPackages(workdir string, deps map[string]bool, lits map[Literal]struct{}, blocks *[]CoverBlock, sonar *[]CoverBlock) {
+// srcDirs contains directories of instrumented packages, see MetaData.SourceDirs.
+var srcDirs = make(map[string]string)
+
+// instrumentPackages type checks and instruments deps. Instrumented files are
+// written to workdir and added to overlay in place of the original files.
+func instrumentPackages(deps map[string]bool, lits map[Literal]struct{}, blocks *[]CoverBlock, sonar *[]CoverBlock, overlay map[string]string) map[string]*types.Package {
 	ignore := map[string]bool{
 		"runtime":                 true, // lots of non-determinism and irrelevant code paths (e.g. different paths in mallocgc, chans and maps)
 		"runtime/internal/atomic": true, // runtime depends on it
@@ -271,6 +635,23 @@ func instrumentPackages(workdir string, deps map[string]bool, lits map[Literal]s
 		ignore["internal/syscall/windows/registry"] = true // time depends on this
 		ignore["io"] = true                                // internal/syscall/windows/registry depends on this
 	}
+	// Anything else go-fuzz-dep depends on creates import cycle as well
+	// (newer runtime depends on more internal packages).
+	ctxt := build.Default
+	ctxt.BuildTags = append(ctxt.BuildTags, "gofuzz")
+	fuzzdep, err := ctxt.ImportDir(goListDir("github.com/dvyukov/go-fuzz/go-fuzz-dep"), 0)
+	if err != nil {
+		failf("failed to import go-fuzz-dep: %v", err)
+	}
+	for _, imp := range fuzzdep.Imports {
+		if imp == "go-fuzz-defs" {
+			continue
+		}
+		ignore[imp] = true
+		for _, p := range goList(imp).Deps {
+			ignore[p] = true
+		}
+	}
 	nolits := map[string]bool{
 		"math":    true,
 		"os":      true,
@@ -285,7 +666,7 @@ func instrumentPackages(workdir string, deps map[string]bool, lits map[Literal]s
 			p = &Package{name: pkg}
 			pkgs[pkg] = p
 		}
-		for _, imp := range goListList(pkg, "Imports") {
+		for _, imp := range goList(pkg).Imports {
 			p1 := pkgs[imp]
 			if p1 == nil {
 				p1 = &Package{name: imp}
@@ -309,10 +690,11 @@ func instrumentPackages(workdir string, deps map[string]bool, lits map[Literal]s
 			p.fset = token.NewFileSet()
 			p.ast = make(map[string]*ast.File)
 			p.info.Types = make(map[ast.Expr]types.TypeAndValue)
-			path := filepath.Join(workdir, "src", p.name)
+			p.info.Uses = make(map[*ast.Ident]types.Object)
+			info := goList(p.name)
 			var files []*ast.File
-			for _, fn := range append(goListList(p.name, "GoFiles"), goListList(p.name, "CgoFiles")...) {
-				astFile, err := parser.ParseFile(p.fset, filepath.Join(path, fn), nil, parser.ParseComments)
+			for _, fn := range info.files() {
+				astFile, err := parser.ParseFile(p.fset, filepath.Join(info.Dir, fn), nil, parser.ParseComments)
 				if err != nil {
 					failf("failed to parse package %v: %v", p.name, err)
 				}
@@ -324,6 +706,9 @@ func instrumentPackages(workdir string, deps map[string]bool, lits map[Literal]s
 			cfg := &types.Config{
 				Packages: typedPackages,
 				Import: func(packages map[string]*types.Package, pkg string) (*types.Package, error) {
+					if vendored, ok := info.ImportMap[pkg]; ok {
+						pkg = vendored
+					}
 					if packages[pkg] == nil {
 						failf("can't find imported package %v", pkg)
 					}
@@ -341,21 +726,23 @@ func instrumentPackages(workdir string, deps map[string]bool, lits map[Literal]s
 				if nolits[p.name] {
 					lits1 = nil
 				}
+				outDir := filepath.Join(workdir, "src", p.name)
+				if err := os.MkdirAll(outDir, 0700); err != nil {
+					failf("failed to create temp dir: %v", err)
+				}
 				for fname, f := range p.ast {
-					fullName := filepath.Join(path, fname)
+					if !instrumentCover(p.name, fname) && !instrumentSonar(p.name, fname) {
+						continue
+					}
+					fullName := filepath.Join(info.Dir, fname)
 					buf := new(bytes.Buffer)
 					content := readFile(fullName)
 					buf.Write(initialComments(content)) // Retain '// +build' directives.
 					instrument(p.name, fname, filepath.Join(p.name, fname), p.fset, f, &p.info, buf, lits1, blocks, sonar)
-					tmp := tempFile()
-					if runtime.GOOS == "windows" {
-						os.Remove(fullName)
-					}
-					writeFile(tmp, buf.Bytes())
-					err := os.Rename(tmp, fullName)
-					if err != nil {
-						failf("failed to rename file: %v", err)
-					}
+					outName := filepath.Join(outDir, fname)
+					writeFile(outName, buf.Bytes())
+					overlay[fullName] = outName
+					srcDirs[p.name] = info.Dir
 				}
 			}
 		}
@@ -367,58 +754,91 @@ func instrumentPackages(workdir string, deps map[string]bool, lits map[Literal]s
 			}
 		}
 	}
+	return typedPackages
 }
 
-func copyDir(dir, newDir string, rec bool, pred func(string) bool) {
-	if err := os.MkdirAll(newDir, 0700); err != nil {
-		failf("failed to create temp dir: %v", err)
-	}
-	files, err := ioutil.ReadDir(dir)
+// GoPackage is a package as described by 'go list -json'.
+type GoPackage struct {
+	ImportPath string
+	Name       string
+	Dir        string
+	GoFiles    []string
+	CgoFiles   []string
+	Imports    []string
+	ImportMap  map[string]string // import path in source -> ImportPath (vendored packages)
+	Deps       []string
+}
+
+func (p *GoPackage) files() []string {
+	return append(append([]string{}, p.GoFiles...), p.CgoFiles...)
+}
+
+var goPackages = make(map[string]*GoPackage)
+
+// goList returns description of the package (import path or relative path).
+// Packages are listed along with all dependencies and cached, so go list
+// is executed once for the fuzzed package. go list resolves packages in the same
+// way as go build (module graph with replace directives, vendor dirs),
+// build tags and -mod are passed to it, so that the set of files is the same.
+func goList(pkg string) *GoPackage {
+	if p := goPackages[pkg]; p != nil {
+		return p
+	}
+	args := append([]string{"list", "-deps", "-json"}, goFlags()...)
+	cmd := exec.Command("go", append(args, pkg)...)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
 	if err != nil {
-		failf("failed to scan dir '%v': %v", dir, err)
+		failf("failed to execute 'go list %v': %v\n%v", pkg, err, stderr.String())
 	}
-	for _, f := range files {
-		if f.IsDir() {
-			if rec {
-				copyDir(filepath.Join(dir, f.Name()), filepath.Join(newDir, f.Name()), rec, pred)
-			}
-			continue
+	var p *GoPackage
+	for dec := json.NewDecoder(bytes.NewReader(out)); dec.More(); {
+		p = new(GoPackage)
+		if err := dec.Decode(p); err != nil {
+			failf("failed to decode go list output: %v", err)
 		}
-		if pred != nil && !pred(f.Name()) {
-			continue
+		if goPackages[p.ImportPath] == nil {
+			goPackages[p.ImportPath] = p
 		}
-		data := readFile(filepath.Join(dir, f.Name()))
-		writeFile(filepath.Join(newDir, f.Name()), data)
 	}
+	if p == nil {
+		failf("go list output for %v is empty", pkg)
+	}
+	// The package itself goes last.
+	goPackages[pkg] = p
+	return p
 }
 
-func goListList(pkg, what string) []string {
-	templ := fmt.Sprintf("{{range .%v}}{{.}}|{{end}}", what)
-	out, err := exec.Command("go", "list", "-tags", "gofuzz", "-f", templ, pkg).CombinedOutput()
+// goListDir returns source dir of the package without resolving its imports
+// (go-fuzz-dep imports go-fuzz-defs as a standard package, it exists only in the overlay).
+func goListDir(pkg string) string {
+	args := append([]string{"list", "-find", "-f", "{{.Dir}}"}, goFlags()...)
+	out, err := exec.Command("go", append(args, pkg)...).CombinedOutput()
 	if err != nil {
-		failf("failed to execute 'go list -f \"%v\" %v': %v\n%v", templ, pkg, err, string(out))
-	}
-	if len(out) < 2 {
-		return nil
+		// go-fuzz-dep is not imported by the package, so it is not vendored.
+		// Take it from the module cache (or from replace directive) instead.
+		args = append(args, "-mod=mod", pkg)
+		if out1, err1 := exec.Command("go", args...).CombinedOutput(); err1 == nil {
+			return strings.TrimSpace(string(out1))
+		}
+		failf("failed to execute 'go list %v': %v\n%v", pkg, err, string(out))
 	}
-	out = out[:len(out)-2]
-	return strings.Split(string(out), "|")
+	return strings.TrimSpace(string(out))
 }
 
-func goListProps(pkg string, props ...string) []string {
-	templ := ""
-	for _, p := range props {
-		templ += fmt.Sprintf("{{.%v}}|", p)
+// goFlags returns flags that go list and go build need to select files
+// in the same way.
+func goFlags() []string {
+	tags := "gofuzz"
+	for _, tag := range strings.FieldsFunc(*flagTags, func(r rune) bool { return r == ',' || r == ' ' }) {
+		tags += "," + tag
 	}
-	out, err := exec.Command("go", "list", "-tags", "gofuzz", "-f", templ, pkg).CombinedOutput()
-	if err != nil {
-		failf("failed to execute 'go list -f \"%v\" %v': %v\n%v", templ, pkg, err, string(out))
-	}
-	if len(out) == 0 {
-		failf("goListProps: go list output is empty")
+	flags := []string{"-tags", tags}
+	if *flagMod != "" {
+		flags = append(flags, "-mod="+*flagMod)
 	}
-	out = out[:len(out)-1]
-	return strings.Split(string(out), "|")
+	return flags
 }
 
 func failf(str string, args ...interface{}) {
@@ -455,6 +875,7 @@ func writeFile(name string, data []byte) {
 func isSourceFile(f string) bool {
 	return (strings.HasSuffix(f, ".go") && !strings.HasSuffix(f, "_test.go")) ||
 		strings.HasSuffix(f, ".s") ||
+		strings.HasSuffix(f, ".syso") ||
 		strings.HasSuffix(f, ".S") ||
 		strings.HasSuffix(f, ".c") ||
 		strings.HasSuffix(f, ".h") ||
@@ -474,9 +895,12 @@ package main
 import (
 	target "%v"
 	dep "go-fuzz-dep"
-)
+%v)
 
 func main() {
-	dep.Main(target.%v)
+	fns := []func([]byte) int{
+%v	}
+%v	dep.Main(fns)
 }
-`
+
+%v`
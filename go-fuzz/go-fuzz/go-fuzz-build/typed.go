@@ -0,0 +1,289 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+	"golang.org/x/tools/go/types"
+)
+
+// TypedGen generates wrappers for structure-aware fuzz functions
+// (functions that accept typed arguments rather than data []byte).
+// A wrapper decodes input data into arguments with go-fuzz-dep.Decoder
+// and calls the fuzz function. Along the way it collects type descriptions
+// for go-fuzz mutator.
+type TypedGen struct {
+	pkg      *types.Package
+	imports  map[string]string // package path -> import name in the generated main
+	decoders map[string]string // type -> name of decode function
+	descs    map[string]int    // type -> index in types
+	types    []TypeDesc
+	funcArgs map[string][]int
+	buf      bytes.Buffer
+}
+
+func newTypedGen(pkg *types.Package) *TypedGen {
+	return &TypedGen{
+		pkg:      pkg,
+		imports:  map[string]string{pkg.Path(): "target"},
+		decoders: make(map[string]string),
+		descs:    make(map[string]int),
+		funcArgs: make(map[string][]int),
+	}
+}
+
+// wrapper generates a wrapper for the fuzz function and returns its name.
+func (g *TypedGen) wrapper(fn string) string {
+	obj, ok := g.pkg.Scope().Lookup(fn).(*types.Func)
+	if !ok {
+		failf("%v is not a function", fn)
+	}
+	sig := obj.Type().(*types.Signature)
+	if sig.Variadic() {
+		failf("variadic fuzz functions are not supported (%v)", fn)
+	}
+	name := "fuzz" + fn
+	var decode, args bytes.Buffer
+	for i := 0; i < sig.Params().Len(); i++ {
+		t := sig.Params().At(i).Type()
+		fmt.Fprintf(&decode, "\tvar a%v %v\n", i, g.typeString(t))
+		fmt.Fprintf(&decode, "\t%v(d, &a%v)\n", g.decoder(t), i)
+		if i != 0 {
+			args.WriteString(", ")
+		}
+		fmt.Fprintf(&args, "a%v", i)
+		g.funcArgs[fn] = append(g.funcArgs[fn], g.desc(t))
+	}
+	fmt.Fprintf(&g.buf, "func %v(data []byte) int {\n\td := dep.NewDecoder(data)\n%v\treturn target.%v(%v)\n}\n\n",
+		name, decode.String(), fn, args.String())
+	return name
+}
+
+// check returns an error if the wrapper for the fuzz function can't be generated
+// because of argument types that can't be decoded.
+func (g *TypedGen) check(fn string) error {
+	obj, ok := g.pkg.Scope().Lookup(fn).(*types.Func)
+	if !ok {
+		return fmt.Errorf("%v: not a function", fn)
+	}
+	sig := obj.Type().(*types.Signature)
+	if sig.Variadic() {
+		return fmt.Errorf("%v: variadic fuzz functions are not supported", fn)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < sig.Params().Len(); i++ {
+		if err := g.checkType(sig.Params().At(i).Type(), seen); err != nil {
+			return fmt.Errorf("%v: %v", fn, err)
+		}
+	}
+	return nil
+}
+
+// checkType mirrors decoder, but returns an error instead of failing.
+func (g *TypedGen) checkType(t types.Type, seen map[string]bool) error {
+	ts := g.typeString(t)
+	if seen[ts] {
+		return nil
+	}
+	seen[ts] = true
+	if named, ok := t.(*types.Named); ok && named.Obj().Pkg() != nil && !named.Obj().Exported() {
+		return fmt.Errorf("type %v of fuzz function argument is not exported", named)
+	}
+	switch tt := t.Underlying().(type) {
+	case *types.Basic:
+		if tt.Info()&(types.IsBoolean|types.IsInteger|types.IsFloat|types.IsString) == 0 {
+			return fmt.Errorf("unsupported type %v of fuzz function argument", t)
+		}
+	case *types.Slice:
+		return g.checkType(tt.Elem(), seen)
+	case *types.Array:
+		return g.checkType(tt.Elem(), seen)
+	case *types.Map:
+		if err := g.checkType(tt.Key(), seen); err != nil {
+			return err
+		}
+		return g.checkType(tt.Elem(), seen)
+	case *types.Struct:
+		for i := 0; i < tt.NumFields(); i++ {
+			if f := tt.Field(i); f.Exported() {
+				if err := g.checkType(f.Type(), seen); err != nil {
+					return err
+				}
+			}
+		}
+	case *types.Pointer:
+		return g.checkType(tt.Elem(), seen)
+	default:
+		return fmt.Errorf("unsupported type %v of fuzz function argument", t)
+	}
+	return nil
+}
+
+// importSrc returns import specs for packages referenced by the generated code
+// (except for the target package which is imported by main).
+func (g *TypedGen) importSrc() string {
+	var paths []string
+	for path := range g.imports {
+		if path != g.pkg.Path() {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	src := ""
+	for _, path := range paths {
+		src += fmt.Sprintf("\t%v %q\n", g.imports[path], path)
+	}
+	return src
+}
+
+func (g *TypedGen) typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		name, ok := g.imports[p.Path()]
+		if !ok {
+			name = fmt.Sprintf("pkg%v", len(g.imports))
+			g.imports[p.Path()] = name
+		}
+		return name
+	})
+}
+
+// decoder generates a function that decodes a value of type t and returns its name.
+func (g *TypedGen) decoder(t types.Type) string {
+	ts := g.typeString(t)
+	if name, ok := g.decoders[ts]; ok {
+		return name
+	}
+	if named, ok := t.(*types.Named); ok && named.Obj().Pkg() != nil && !named.Obj().Exported() {
+		failf("type %v of fuzz function argument is not exported", named)
+	}
+	name := fmt.Sprintf("decode%v", len(g.decoders))
+	g.decoders[ts] = name // register before generating body to support recursive types
+	body := ""
+	switch tt := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case tt.Info()&types.IsBoolean != 0:
+			body = fmt.Sprintf("\t*v = %v(d.Bool())\n", ts)
+		case tt.Info()&types.IsUnsigned != 0:
+			body = fmt.Sprintf("\t*v = %v(d.Uint(%v))\n", ts, basicSize(tt))
+		case tt.Info()&types.IsInteger != 0:
+			body = fmt.Sprintf("\t*v = %v(d.Int(%v))\n", ts, basicSize(tt))
+		case tt.Info()&types.IsFloat != 0:
+			body = fmt.Sprintf("\t*v = %v(d.Float%v())\n", ts, basicSize(tt)*8)
+		case tt.Info()&types.IsString != 0:
+			body = fmt.Sprintf("\t*v = %v(d.String())\n", ts)
+		default:
+			failf("unsupported type %v of fuzz function argument", t)
+		}
+	case *types.Slice:
+		if isByte(tt.Elem()) {
+			body = fmt.Sprintf("\t*v = %v(d.Bytes())\n", ts)
+			break
+		}
+		body = fmt.Sprintf("\t*v = make(%v, d.Len())\n\tfor i := range *v {\n\t\t%v(d, &(*v)[i])\n\t}\n",
+			ts, g.decoder(tt.Elem()))
+	case *types.Array:
+		body = fmt.Sprintf("\tfor i := range *v {\n\t\t%v(d, &(*v)[i])\n\t}\n", g.decoder(tt.Elem()))
+	case *types.Map:
+		body = fmt.Sprintf("\tn := d.Len()\n\t*v = make(%v, n)\n\tfor i := 0; i < n; i++ {\n"+
+			"\t\tvar k %v\n\t\t%v(d, &k)\n\t\tvar e %v\n\t\t%v(d, &e)\n\t\t(*v)[k] = e\n\t}\n",
+			ts, g.typeString(tt.Key()), g.decoder(tt.Key()), g.typeString(tt.Elem()), g.decoder(tt.Elem()))
+	case *types.Struct:
+		for i := 0; i < tt.NumFields(); i++ {
+			f := tt.Field(i)
+			if !f.Exported() {
+				continue
+			}
+			body += fmt.Sprintf("\t%v(d, &v.%v)\n", g.decoder(f.Type()), f.Name())
+		}
+	case *types.Pointer:
+		body = fmt.Sprintf("\tif d.Bool() {\n\t\t*v = new(%v)\n\t\t%v(d, *v)\n\t}\n",
+			g.typeString(tt.Elem()), g.decoder(tt.Elem()))
+	default:
+		failf("unsupported type %v of fuzz function argument", t)
+	}
+	fmt.Fprintf(&g.buf, "func %v(d *dep.Decoder, v *%v) {\n%v}\n\n", name, ts, body)
+	return name
+}
+
+// desc returns index of description of type t in g.types.
+// Must be called after g.decoder for the type, so that the type is already checked.
+func (g *TypedGen) desc(t types.Type) int {
+	ts := g.typeString(t)
+	if idx, ok := g.descs[ts]; ok {
+		return idx
+	}
+	idx := len(g.types)
+	g.descs[ts] = idx
+	g.types = append(g.types, TypeDesc{Name: ts})
+	d := TypeDesc{Name: ts}
+	switch tt := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case tt.Info()&types.IsBoolean != 0:
+			d.Kind = TypeBool
+		case tt.Info()&types.IsUnsigned != 0:
+			d.Kind = TypeUint
+			d.Size = basicSize(tt)
+		case tt.Info()&types.IsInteger != 0:
+			d.Kind = TypeInt
+			d.Size = basicSize(tt)
+		case tt.Info()&types.IsFloat != 0:
+			d.Kind = TypeFloat
+			d.Size = basicSize(tt)
+		case tt.Info()&types.IsString != 0:
+			d.Kind = TypeString
+		}
+	case *types.Slice:
+		if isByte(tt.Elem()) {
+			d.Kind = TypeString
+			break
+		}
+		d.Kind = TypeSlice
+		d.Elem = g.desc(tt.Elem())
+	case *types.Array:
+		d.Kind = TypeArray
+		d.Size = int(tt.Len())
+		d.Elem = g.desc(tt.Elem())
+	case *types.Map:
+		d.Kind = TypeMap
+		d.Key = g.desc(tt.Key())
+		d.Elem = g.desc(tt.Elem())
+	case *types.Struct:
+		d.Kind = TypeStruct
+		for i := 0; i < tt.NumFields(); i++ {
+			if f := tt.Field(i); f.Exported() {
+				d.Fields = append(d.Fields, g.desc(f.Type()))
+			}
+		}
+	case *types.Pointer:
+		d.Kind = TypePtr
+		d.Elem = g.desc(tt.Elem())
+	}
+	g.types[idx] = d
+	return idx
+}
+
+func basicSize(t *types.Basic) int {
+	switch t.Kind() {
+	case types.Int8, types.Uint8:
+		return 1
+	case types.Int16, types.Uint16:
+		return 2
+	case types.Int32, types.Uint32, types.Float32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+func isByte(t types.Type) bool {
+	// Note: slices of named byte types are encoded element-by-element.
+	b, ok := t.(*types.Basic)
+	return ok && b.Kind() == types.Uint8
+}
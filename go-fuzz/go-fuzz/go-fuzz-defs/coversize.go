@@ -0,0 +1,10 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package base
+
+// CoverSize is the default size of coverage table.
+// go-fuzz-build overwrites this file in its copy of the package if the table
+// size is changed with -coversize flag, so in go-fuzz-dep CoverSize is always
+// the actual size. go-fuzz itself must use MetaData.CoverSize.
+const CoverSize = 64 << 10
@@ -4,11 +4,48 @@
 package base
 
 const (
-	CoverSize       = 64 << 10
 	MaxInputSize    = 1 << 20
 	SonarRegionSize = 1 << 20
+
+	// ValueProfileSize is the size of value profile table. In value profile mode
+	// comparisons record how close the operands were, so getting closer to
+	// flipping a comparison is treated as new coverage.
+	ValueProfileSize = 4 << 10
+	// CoverRegionSize is the size of the region with coverage table followed by value profile table.
+	// The whole region is treated as coverage.
+	CoverRegionSize = CoverSize + ValueProfileSize
+
+	// InProcRegionSize is the size of the region used by in-process fuzzing:
+	// max cover followed by length of the input that is being executed.
+	InProcRegionSize = CoverRegionSize + 8
+	CommSize         = CoverRegionSize + MaxInputSize + SonarRegionSize + InProcRegionSize
+)
+
+// Status of in-process fuzzing batch returned by the testee.
+const (
+	InProcNone     = iota // all iterations are done, nothing interesting found
+	InProcNewCover        // input in the input region gives new coverage
+	InProcPanic           // input in the input region panics
+	InProcOOM             // input in the input region allocates more than the memory limit
 )
 
+// Hooks that go-fuzz can ask the testee to run on the input region instead of
+// executing the fuzz function: FuzzMutate(data []byte, seed int64) []byte and
+// FuzzPostProcess(data []byte) []byte functions of the fuzzed package.
+// The result replaces the input, reply status is InProcPanic if a hook panics.
+const (
+	HookMutate = 1 << iota
+	HookPostProcess
+)
+
+// MemLimitMsg is printed when an input exceeds memory limit (-memlimit flag of go-fuzz).
+const MemLimitMsg = "fatal error: memory limit exceeded"
+
+// DiffMsg is printed when two functions of a differential fuzz function
+// (-diff flag of go-fuzz-build) disagree on an input. The rest of the line
+// names the functions and the kind of disagreement, it is used to bucket crashes.
+const DiffMsg = "fatal error: differential mismatch"
+
 const (
 	SonarEQL = iota
 	SonarNEQ
@@ -28,6 +65,14 @@ const (
 	SonarMaxLen = 20
 )
 
+// Part of the first operand that is compared with the second operand
+// by SonarBytes/SonarStrings hooks (used for bytes/strings functions).
+const (
+	SonarMatchEqual = iota
+	SonarMatchPrefix
+	SonarMatchSuffix
+)
+
 type CoverBlock struct {
 	ID        int
 	File      string
@@ -43,8 +88,83 @@ type Literal struct {
 	IsStr bool
 }
 
+// Structure-aware fuzz functions accept arbitrary typed arguments, e.g.:
+//
+//	func FuzzFoo(a int, s string, m MyStruct) int
+//
+// Input data is decoded into arguments as follows:
+//
+//	bool: 1 byte, low bit is the value
+//	integers and floats: Size bytes in little-endian
+//	strings and []byte: uvarint length followed by the bytes
+//	slices and maps: uvarint length followed by elements (key/value pairs for maps)
+//	arrays: Size elements
+//	structs: exported fields in declaration order (unexported fields are left zero)
+//	pointers: 1 byte, if the low bit is set the pointer is not nil and the element follows
+//
+// Lengths are clamped to the remaining data (and to TypedMaxLen for slices and maps),
+// missing data decodes as zero values. So any data can be decoded,
+// and decoded arguments can be encoded back.
+const (
+	TypeBool = iota
+	TypeInt
+	TypeUint
+	TypeFloat
+	TypeString // string or []byte
+	TypeSlice
+	TypeArray
+	TypeMap
+	TypeStruct
+	TypePtr
+
+	TypedMaxLen = 1 << 10
+)
+
+// TypeDesc describes type of an argument of a structure-aware fuzz function.
+// Element types are referenced by index in MetaData.Types, this allows recursive types.
+type TypeDesc struct {
+	Kind   int
+	Name   string // Go type, for debugging
+	Size   int    // size of integers and floats in bytes, length of arrays
+	Elem   int    // element type of slices, arrays, maps and pointers
+	Key    int    // key type of maps
+	Fields []int  // types of exported struct fields
+}
+
 type MetaData struct {
 	Literals []Literal
 	Blocks   []CoverBlock
 	Sonar    []CoverBlock
+	Funcs    []string         // fuzz functions in the order they are passed to go-fuzz-dep.Main
+	Types    []TypeDesc       // types of arguments of structure-aware fuzz functions
+	FuncArgs map[string][]int // argument types of structure-aware fuzz functions
+	Checked  string           // go build flags of the checked binary (empty if there is no checked binary)
+	// CoverSize is the size of coverage table the binaries are built with
+	// (-coversize flag of go-fuzz-build), 0 means the default CoverSize.
+	CoverSize int
+	// Edges is set if coverage table is indexed by hash of the previous and
+	// the current block (-edges flag of go-fuzz-build) rather than by block ID.
+	Edges bool
+	// Mutate and PostProcess are set if the package has FuzzMutate and
+	// FuzzPostProcess hooks respectively (see HookMutate).
+	Mutate      bool
+	PostProcess bool
+	// Filter is the set of packages and files that are instrumented.
+	Filter InstrFilter
+	// SourceDirs maps import paths of instrumented packages to their absolute
+	// directories on the build machine. CoverBlock.File is the import path
+	// joined with the file name, source of the file is in SourceDirs[import path].
+	SourceDirs map[string]string
+}
+
+// InstrFilter describes -include/-exclude flags of go-fuzz-build.
+// Patterns are globs matched against package import paths and pkg/file.go
+// names (patterns without slashes are matched against file names as well,
+// pkg/... matches pkg and all packages below it). Empty Include means everything.
+// Block coverage and sonar are filtered separately.
+type InstrFilter struct {
+	Include      []string
+	Exclude      []string
+	SonarInclude []string
+	SonarExclude []string
 }
@@ -0,0 +1,99 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// +build gofuzz
+
+package gofuzzdep
+
+import (
+	"unsafe"
+
+	. "go-fuzz-defs"
+)
+
+// Decoder decodes input data into arguments of structure-aware fuzz functions.
+// Code generated by go-fuzz-build uses it to unpack arguments.
+// The encoding is described in go-fuzz-defs.
+type Decoder struct {
+	data []byte
+}
+
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data}
+}
+
+func (d *Decoder) Bool() bool {
+	if len(d.data) == 0 {
+		return false
+	}
+	v := d.data[0]&1 != 0
+	d.data = d.data[1:]
+	return v
+}
+
+func (d *Decoder) Uint(size int) uint64 {
+	var v uint64
+	for i := 0; i < size; i++ {
+		if len(d.data) == 0 {
+			break
+		}
+		v |= uint64(d.data[0]) << uint(i*8)
+		d.data = d.data[1:]
+	}
+	return v
+}
+
+func (d *Decoder) Int(size int) int64 {
+	shift := uint(64 - size*8)
+	return int64(d.Uint(size)<<shift) >> shift
+}
+
+func (d *Decoder) Float32() float32 {
+	v := uint32(d.Uint(4))
+	return *(*float32)(unsafe.Pointer(&v))
+}
+
+func (d *Decoder) Float64() float64 {
+	v := d.Uint(8)
+	return *(*float64)(unsafe.Pointer(&v))
+}
+
+func (d *Decoder) Bytes() []byte {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		n = uint64(len(d.data))
+	}
+	v := make([]byte, n)
+	copy(v, d.data)
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *Decoder) String() string {
+	return string(d.Bytes())
+}
+
+// Len returns length of a slice or a map.
+func (d *Decoder) Len() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		n = uint64(len(d.data))
+	}
+	if n > TypedMaxLen {
+		n = TypedMaxLen
+	}
+	return int(n)
+}
+
+func (d *Decoder) uvarint() uint64 {
+	var v uint64
+	for i := 0; i < 10 && len(d.data) != 0; i++ {
+		b := d.data[0]
+		d.data = d.data[1:]
+		v |= uint64(b&0x7f) << uint(i*7)
+		if b < 0x80 {
+			break
+		}
+	}
+	return v
+}
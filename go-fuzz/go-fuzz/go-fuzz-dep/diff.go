@@ -0,0 +1,71 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// +build gofuzz
+
+package gofuzzdep
+
+import (
+	"syscall"
+
+	. "go-fuzz-defs"
+)
+
+// Diff returns a fuzz function that executes f1 and f2 on the same input
+// and crashes if they disagree: one of them fails and the other does not,
+// or both succeed but return different outputs. Errors are not compared,
+// different implementations rarely produce the same error messages.
+// The returned function is generated by go-fuzz-build for -diff flag.
+func Diff(name1 string, f1 func([]byte) ([]byte, error), name2 string, f2 func([]byte) ([]byte, error)) func([]byte) int {
+	var data2 []byte
+	return func(data []byte) int {
+		// f1 can change the input, f2 must see the original one.
+		data2 = append(data2[:0], data...)
+		out1, err1 := f1(data)
+		out2, err2 := f2(data2)
+		switch {
+		case err1 != nil && err2 != nil:
+			return 0
+		case err1 != nil:
+			diffCrash(name1, name2, name1+" failed", out1, err1, out2, err2)
+		case err2 != nil:
+			diffCrash(name1, name2, name2+" failed", out1, err1, out2, err2)
+		case string(out1) != string(out2):
+			diffCrash(name1, name2, "outputs differ", out1, err1, out2, err2)
+		}
+		return 1
+	}
+}
+
+func diffCrash(name1, name2, what string, out1 []byte, err1 error, out2 []byte, err2 error) {
+	print(DiffMsg, ": ", name1, " vs ", name2, ": ", what, "\n\n")
+	printResult(name1, out1, err1)
+	printResult(name2, out2, err2)
+	syscall.Exit(2)
+}
+
+func printResult(name string, out []byte, err error) {
+	if err != nil {
+		print(name, " error: ", err.Error(), "\n\n")
+		return
+	}
+	print(name, " output (", len(out), " bytes):\n")
+	// The output can be binary, print it escaped.
+	const hex = "0123456789abcdef"
+	buf := make([]byte, 0, len(out)+2)
+	buf = append(buf, '"')
+	for _, c := range out {
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c == '\n':
+			buf = append(buf, '\\', 'n')
+		case c >= 0x20 && c < 0x7f:
+			buf = append(buf, c)
+		default:
+			buf = append(buf, '\\', 'x', hex[c>>4], hex[c&0xf])
+		}
+	}
+	buf = append(buf, '"', '\n', '\n')
+	print(string(buf))
+}
@@ -0,0 +1,195 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// +build gofuzz
+
+package gofuzzdep
+
+import (
+	"sync/atomic"
+	"time"
+
+	. "go-fuzz-defs"
+)
+
+// In-process fuzzing mode: the testee mutates the seed input itself and
+// executes mutants in a loop, so cheap Fuzz functions don't pay for
+// the pipe round trip on every input. The batch ends as soon as an input
+// gives new coverage (relative to maxCover supplied by go-fuzz) or panics.
+// Fatal errors and hangs kill the process as usual; in such case inputLen
+// tells go-fuzz what input was being executed.
+
+var (
+	inprocMut  *mutator
+	inprocSeed []byte
+	inprocData []byte
+)
+
+func fuzzInProcess(f func([]byte) int, n, iters uint64) (res, status, execs, ln uint64) {
+	if inprocMut == nil {
+		inprocMut = &mutator{x: uint64(time.Now().UnixNano()) | 1}
+		inprocSeed = make([]byte, 0, MaxInputSize)
+		inprocData = make([]byte, 0, MaxInputSize)
+	}
+	inprocSeed = append(inprocSeed[:0], input[:n]...)
+	for execs < iters {
+		data := inprocMut.mutate(append(inprocData[:0], inprocSeed...))
+		copy(input, data)
+		atomic.StoreUint64(inputLen, uint64(len(data)))
+		resetCover()
+		execs++
+		heapGrowth(true)
+		r, panicked := runProtected(f, input[:len(data)])
+		alloc := heapGrowth(false)
+		if panicked {
+			// The Fuzz function could have changed the input.
+			copy(input, data)
+			return 0, InProcPanic, execs, uint64(len(data))
+		}
+		if memLimit != 0 && alloc > memLimit {
+			copy(input, data)
+			return 0, InProcOOM, execs, uint64(len(data))
+		}
+		if r >= 0 && newCover() {
+			copy(input, data)
+			return uint64(r), InProcNewCover, execs, uint64(len(data))
+		}
+	}
+	return 0, InProcNone, execs, 0
+}
+
+func runProtected(f func([]byte) int, data []byte) (res int, panicked bool) {
+	defer func() {
+		if recover() != nil {
+			panicked = true
+		}
+	}()
+	return f(data), false
+}
+
+func newCover() bool {
+	for i, v := range coverRegion {
+		if v > maxCover[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// mutator is a stripped down version of go-fuzz mutator.
+// go-fuzz-dep can't import math/rand or anything else that is instrumented.
+type mutator struct {
+	x uint64
+}
+
+func (m *mutator) rand(n int) int {
+	// xorshift64
+	m.x ^= m.x << 13
+	m.x ^= m.x >> 7
+	m.x ^= m.x << 17
+	return int(m.x % uint64(n))
+}
+
+func (m *mutator) chooseLen(n int) int {
+	if n > 8 && m.rand(10) != 0 {
+		n = 8
+	}
+	return m.rand(n) + 1
+}
+
+var interesting = []byte{0x80, 0xff, 0, 1, 16, 32, 64, 100, 127}
+
+func (m *mutator) mutate(res []byte) []byte {
+	nm := 1
+	for m.rand(2) == 0 {
+		nm++
+	}
+	for iter := 0; iter < nm; iter++ {
+		switch m.rand(8) {
+		case 0:
+			// Remove a range of bytes.
+			if len(res) <= 1 {
+				iter--
+				continue
+			}
+			pos0 := m.rand(len(res))
+			pos1 := pos0 + m.chooseLen(len(res)-pos0)
+			copy(res[pos0:], res[pos1:])
+			res = res[:len(res)-(pos1-pos0)]
+		case 1:
+			// Insert a range of random bytes.
+			pos := m.rand(len(res) + 1)
+			n := m.chooseLen(10)
+			for i := 0; i < n; i++ {
+				res = append(res, 0)
+			}
+			copy(res[pos+n:], res[pos:])
+			for i := 0; i < n; i++ {
+				res[pos+i] = byte(m.rand(256))
+			}
+		case 2:
+			// Duplicate a range of bytes.
+			if len(res) <= 1 {
+				iter--
+				continue
+			}
+			src := m.rand(len(res))
+			dst := m.rand(len(res))
+			n := m.chooseLen(len(res) - src)
+			tmp := make([]byte, n)
+			copy(tmp, res[src:])
+			for i := 0; i < n; i++ {
+				res = append(res, 0)
+			}
+			copy(res[dst+n:], res[dst:])
+			copy(res[dst:], tmp)
+		case 3:
+			// Bit flip.
+			if len(res) == 0 {
+				iter--
+				continue
+			}
+			res[m.rand(len(res))] ^= 1 << uint(m.rand(8))
+		case 4:
+			// Set a byte to a random value.
+			if len(res) == 0 {
+				iter--
+				continue
+			}
+			res[m.rand(len(res))] ^= byte(m.rand(255)) + 1
+		case 5:
+			// Swap 2 bytes.
+			if len(res) <= 1 {
+				iter--
+				continue
+			}
+			src := m.rand(len(res))
+			dst := m.rand(len(res))
+			res[src], res[dst] = res[dst], res[src]
+		case 6:
+			// Add/subtract from a byte.
+			if len(res) == 0 {
+				iter--
+				continue
+			}
+			pos := m.rand(len(res))
+			v := byte(m.rand(35) + 1)
+			if m.rand(2) == 0 {
+				res[pos] += v
+			} else {
+				res[pos] -= v
+			}
+		case 7:
+			// Replace a byte with an interesting value.
+			if len(res) == 0 {
+				iter--
+				continue
+			}
+			res[m.rand(len(res))] = interesting[m.rand(len(interesting))]
+		}
+	}
+	if len(res) > MaxInputSize {
+		res = res[:MaxInputSize]
+	}
+	return res
+}
@@ -19,37 +19,147 @@ var (
 	inFD  FD
 	outFD FD
 
-	CoverTab    *[CoverSize]byte
-	input       []byte
-	sonarRegion []byte
-	sonarPos    uint32
+	CoverTab     *[CoverSize]byte
+	coverRegion  []byte // CoverTab followed by valueProfile
+	valueProfile []byte
+	input        []byte
+	sonarRegion  []byte
+	sonarPos     uint32
+	maxCover     []byte
+	inputLen     *uint64
+	prevBlock    int
+
+	mutateHook      func([]byte, int64) []byte
+	postProcessHook func([]byte) []byte
 )
 
 func init() {
 	var mem []byte
 	mem, inFD, outFD = setupCommFile()
 	CoverTab = (*[CoverSize]byte)(unsafe.Pointer(&mem[0]))
-	input = mem[CoverSize : CoverSize+MaxInputSize]
-	sonarRegion = mem[CoverSize+MaxInputSize:]
+	coverRegion = mem[:CoverRegionSize]
+	valueProfile = mem[CoverSize:CoverRegionSize]
+	input = mem[CoverRegionSize : CoverRegionSize+MaxInputSize]
+	sonarRegion = mem[CoverRegionSize+MaxInputSize : CoverRegionSize+MaxInputSize+SonarRegionSize]
+	inproc := mem[CoverRegionSize+MaxInputSize+SonarRegionSize:]
+	maxCover = inproc[:CoverRegionSize]
+	inputLen = (*uint64)(unsafe.Pointer(&inproc[CoverRegionSize]))
 }
 
-func Main(f func([]byte) int) {
+// Main runs the fuzz function selected by go-fuzz out of fns.
+func Main(fns []func([]byte) int) {
 	runtime.GOMAXPROCS(1) // makes coverage more deterministic, we parallelize on higher level
+	f := selectFunc(fns)
+	initMemLimit()
 	for {
 		n := read(inFD)
+		iters := read(inFD)
+		hooks := read(inFD)
+		seed := read(inFD)
 		if n > uint64(len(input)) {
 			println("invalid input length")
 			syscall.Exit(1)
 		}
-		for i := range CoverTab {
-			CoverTab[i] = 0
+		if hooks != 0 {
+			ln, status := runHooks(n, hooks, int64(seed))
+			write(outFD, 0, 0, 0, 0, status, ln)
+			continue
+		}
+		if iters != 0 {
+			res, status, execs, ln := fuzzInProcess(f, n, iters)
+			write(outFD, res, 0, 0, execs, status, ln)
+			continue
 		}
-		atomic.StoreUint32(&sonarPos, 0)
+		resetCover()
+		saveInput(input[:n])
+		heapGrowth(true)
 		t0 := time.Now()
 		res := f(input[:n])
 		ns := time.Since(t0)
-		write(outFD, uint64(res), uint64(ns), uint64(atomic.LoadUint32(&sonarPos)))
+		if growth := heapGrowth(false); growth > memLimit && memLimit != 0 {
+			memLimitCrash(f, growth)
+		}
+		write(outFD, uint64(res), uint64(ns), uint64(atomic.LoadUint32(&sonarPos)), 1, InProcNone, n)
+	}
+}
+
+// SetHooks is called by the generated main function before Main if the fuzzed
+// package has FuzzMutate and/or FuzzPostProcess functions (nil otherwise).
+func SetHooks(mutate func(data []byte, seed int64) []byte, postProcess func(data []byte) []byte) {
+	mutateHook = mutate
+	postProcessHook = postProcess
+}
+
+// runHooks applies the requested Hook* functions to the input
+// and replaces the input with the result.
+func runHooks(n, hooks uint64, seed int64) (ln, status uint64) {
+	data := make([]byte, n)
+	copy(data, input[:n])
+	panicked := true
+	func() {
+		defer func() {
+			recover()
+		}()
+		if hooks&HookMutate != 0 && mutateHook != nil {
+			data = mutateHook(data, seed)
+		}
+		if hooks&HookPostProcess != 0 && postProcessHook != nil {
+			data = postProcessHook(data)
+		}
+		panicked = false
+	}()
+	if panicked {
+		return n, InProcPanic
+	}
+	return uint64(copy(input, data)), InProcNone
+}
+
+// Edge is called by instrumentation code in edge coverage mode
+// (-edges flag of go-fuzz-build) instead of indexing CoverTab by block ID.
+// It returns CoverTab index of the transition from the previously executed
+// block to block cur. The previous block is shifted, so that A->B and B->A
+// transitions, as well as tight loops A->A, get different indexes.
+// Accesses to prevBlock from different goroutines race by design,
+// it must not be flagged in race-enabled checked binaries.
+//
+//go:norace
+func Edge(cur int) int {
+	idx := cur ^ prevBlock
+	prevBlock = cur >> 1
+	return idx
+}
+
+// resetCover prepares coverage and sonar regions for the next input.
+func resetCover() {
+	for i := range coverRegion {
+		coverRegion[i] = 0
+	}
+	prevBlock = 0
+	atomic.StoreUint32(&sonarPos, 0)
+}
+
+// selectFunc returns fuzz function with index passed in GO_FUZZ_FUNC env var.
+func selectFunc(fns []func([]byte) int) func([]byte) int {
+	idx := int(envUint("GO_FUZZ_FUNC"))
+	if idx >= len(fns) {
+		println("fuzz function index", idx, "is out of range, have", len(fns), "functions")
+		syscall.Exit(1)
+	}
+	return fns[idx]
+}
+
+// envUint returns decimal value of env var name (0 if not set).
+func envUint(name string) uint64 {
+	v, _ := syscall.Getenv(name)
+	var res uint64
+	for i := 0; i < len(v); i++ {
+		if v[i] < '0' || v[i] > '9' {
+			println("bad", name, "value", v)
+			syscall.Exit(1)
+		}
+		res = res*10 + uint64(v[i]-'0')
 	}
+	return res
 }
 
 // read reads little-endian-encoded uint64 from fd.
@@ -75,7 +185,7 @@ func read(fd FD) uint64 {
 
 // write writes little-endian-encoded vals... to fd.
 func write(fd FD, vals ...uint64) {
-	var tmp [3 * 8]byte
+	var tmp [6 * 8]byte
 	buf := tmp[:len(vals)*8]
 	for i, v := range vals {
 		for j := 0; j < 8; j++ {
@@ -0,0 +1,165 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// +build gofuzz
+
+package gofuzzdep
+
+import (
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	. "go-fuzz-defs"
+)
+
+// memLimit is the memory limit in bytes passed by go-fuzz in GO_FUZZ_MEMLIMIT env var
+// (0 means no limit). With the limit the testee reports heap growth caused
+// by every input, and kills itself if heap grows beyond the limit while an input
+// is being executed (otherwise a single input can exhaust memory of the machine).
+var memLimit uint64
+
+var (
+	executing  uint32 // set while the fuzz function is running
+	heapBase   uint64 // heap size before execution of the current input
+	savedInput []byte // copy of the current input, the fuzz function can change it
+)
+
+func initMemLimit() {
+	memLimit = envUint("GO_FUZZ_MEMLIMIT")
+	if memLimit != 0 {
+		go memWatchdog()
+	}
+}
+
+// heapGrowth marks start/end of execution of an input for the watchdog.
+// At the end it returns how much the heap has grown during the execution.
+// Garbage left by the input is not counted: if the growth exceeds the limit,
+// it is measured again after a garbage collection.
+func heapGrowth(start bool) uint64 {
+	if memLimit == 0 {
+		return 0
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if start {
+		atomic.StoreUint64(&heapBase, ms.HeapAlloc)
+		atomic.StoreUint32(&executing, 1)
+		return 0
+	}
+	atomic.StoreUint32(&executing, 0)
+	if growth(ms.HeapAlloc) <= memLimit {
+		return growth(ms.HeapAlloc)
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	return growth(ms.HeapAlloc)
+}
+
+// saveInput remembers the input for memLimitCrash.
+func saveInput(data []byte) {
+	if memLimit != 0 {
+		savedInput = append(savedInput[:0], data...)
+	}
+}
+
+// memLimitCrash kills the process when the heap has grown by more than
+// the limit during execution of the input, but the watchdog did not notice it.
+// The stack that allocated the memory is lost by then, so the input is executed
+// again with profiling of all allocations, and the stack that allocated
+// the most is printed (otherwise all such crashers would have the same suppression).
+func memLimitCrash(f func([]byte) int, heap uint64) {
+	runtime.MemProfileRate = 1
+	before := memProfile()
+	f(savedInput)
+	after := memProfile()
+	var stack []uintptr
+	var max int64
+	for stk, bytes := range after {
+		if bytes-before[stk] > max {
+			max = bytes - before[stk]
+			stack = stk[:]
+		}
+	}
+	print(MemLimitMsg, "\nheap grew by ", heap>>20, " MB, limit ", memLimit>>20, " MB\n\n")
+	if stack != nil {
+		print("goroutine 1 [running]:\n")
+		frames := runtime.CallersFrames(stack)
+		for {
+			frame, more := frames.Next()
+			if frame.Function != "" {
+				print(frame.Function, "(...)\n\t", frame.File, ":", frame.Line, "\n")
+			}
+			if !more {
+				break
+			}
+		}
+		print("\n")
+	}
+	syscall.Exit(2)
+}
+
+// memProfile returns number of bytes allocated so far by every allocation stack.
+func memProfile() map[[32]uintptr]int64 {
+	// The profile is updated by garbage collections.
+	runtime.GC()
+	var recs []runtime.MemProfileRecord
+	n, ok := runtime.MemProfile(nil, true)
+	for !ok {
+		recs = make([]runtime.MemProfileRecord, n+64)
+		n, ok = runtime.MemProfile(recs, true)
+	}
+	res := make(map[[32]uintptr]int64)
+	for _, r := range recs[:n] {
+		res[r.Stack0] += r.AllocBytes
+	}
+	return res
+}
+
+// growth returns heap growth since the start of the current input.
+func growth(heap uint64) uint64 {
+	base := atomic.LoadUint64(&heapBase)
+	if heap < base {
+		return 0
+	}
+	return heap - base
+}
+
+func memWatchdog() {
+	for {
+		time.Sleep(100 * time.Millisecond)
+		if atomic.LoadUint32(&executing) == 0 {
+			continue
+		}
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		if growth(ms.HeapAlloc) <= memLimit {
+			continue
+		}
+		// HeapAlloc includes garbage that is not yet collected.
+		runtime.GC()
+		runtime.ReadMemStats(&ms)
+		if growth(ms.HeapAlloc) <= memLimit || atomic.LoadUint32(&executing) == 0 {
+			continue
+		}
+		print(MemLimitMsg, "\nheap grew by ", growth(ms.HeapAlloc)>>20, " MB, limit ", memLimit>>20, " MB\n\n")
+		// Print only stack of the goroutine that executes the fuzz function,
+		// stack of this goroutine is useless for crash bucketing.
+		buf := make([]byte, 1<<20)
+		stacks := buf[:runtime.Stack(buf, true)]
+		const hdr = "goroutine 1 ["
+		for i := 0; i+len(hdr) <= len(stacks); i++ {
+			if string(stacks[i:i+len(hdr)]) != hdr || i != 0 && stacks[i-1] != '\n' {
+				continue
+			}
+			end := i
+			for end < len(stacks) && !(stacks[end] == '\n' && end > 0 && stacks[end-1] == '\n') {
+				end++
+			}
+			print(string(stacks[i:end]), "\n")
+			break
+		}
+		syscall.Exit(2)
+	}
+}
@@ -58,6 +58,87 @@ func Sonar(v1, v2 interface{}, id uint32) {
 	copy(sonarRegion[pos:pos+n], buf[:])
 }
 
+// ValueProfile is called by instrumentation code instead of Sonar in value profile mode.
+// It records how close operands of a comparison are (number of equal bits
+// for integers, length of common prefix for strings) in the value profile table.
+// The table is part of coverage, so inputs that get closer to flipping
+// the comparison are considered interesting.
+func ValueProfile(v1, v2 interface{}, id uint32) {
+	var buf [2 * SonarMaxLen]byte
+	n1, f1 := serialize(v1, v2, buf[:])
+	if n1 == failure {
+		return
+	}
+	n2, _ := serialize(v2, v1, buf[n1:])
+	if n2 == failure {
+		return
+	}
+	b1, b2 := buf[:n1], buf[n1:n1+n2]
+	score := 1 // non-zero means that the comparison was executed
+	if f1&SonarString != 0 {
+		for i := 0; i < len(b1) && i < len(b2) && b1[i] == b2[i]; i++ {
+			score += 8
+		}
+	} else {
+		for i := 0; i < len(b1) && i < len(b2); i++ {
+			for x := b1[i] ^ b2[i]; x != 0; x &= x - 1 {
+				score--
+			}
+			score += 8
+		}
+	}
+	if score > 255 {
+		score = 255
+	}
+	idx := (id >> 8) % ValueProfileSize // low 8 bits are flags
+	if valueProfile[idx] < uint8(score) {
+		valueProfile[idx] = uint8(score)
+	}
+}
+
+// SonarBytes is called by instrumentation code for calls of bytes package
+// functions that compare its arguments (e.g. bytes.HasPrefix(v1, v2)).
+// It returns its arguments, so that the call is rewritten as
+// bytes.HasPrefix(SonarBytes(v1, v2, id, SonarMatchPrefix)).
+func SonarBytes(v1, v2 []byte, id uint32, match int) ([]byte, []byte) {
+	lo, hi := matchPart(len(v1), len(v2), match)
+	Sonar(v1[lo:hi], v2, id)
+	return v1, v2
+}
+
+// SonarStrings is the same as SonarBytes, but for strings package functions.
+func SonarStrings(v1, v2 string, id uint32, match int) (string, string) {
+	lo, hi := matchPart(len(v1), len(v2), match)
+	Sonar(v1[lo:hi], v2, id)
+	return v1, v2
+}
+
+// ValueProfileBytes is called instead of SonarBytes in value profile mode.
+func ValueProfileBytes(v1, v2 []byte, id uint32, match int) ([]byte, []byte) {
+	lo, hi := matchPart(len(v1), len(v2), match)
+	ValueProfile(v1[lo:hi], v2, id)
+	return v1, v2
+}
+
+// ValueProfileStrings is called instead of SonarStrings in value profile mode.
+func ValueProfileStrings(v1, v2 string, id uint32, match int) (string, string) {
+	lo, hi := matchPart(len(v1), len(v2), match)
+	ValueProfile(v1[lo:hi], v2, id)
+	return v1, v2
+}
+
+// matchPart returns bounds of the part of the first operand
+// (of length n1) that is compared with the second operand (of length n2).
+func matchPart(n1, n2, match int) (lo, hi int) {
+	if n2 > n1 || match == SonarMatchEqual {
+		return 0, n1
+	}
+	if match == SonarMatchSuffix {
+		return n1 - n2, n1
+	}
+	return 0, n2
+}
+
 func serialize(v, v2 interface{}, buf []byte) (n, flags uint8) {
 	switch vv := v.(type) {
 	case int8:
@@ -95,6 +176,11 @@ func serialize(v, v2 interface{}, buf []byte) (n, flags uint8) {
 			return failure, 0
 		}
 		return uint8(copy(buf, vv)), SonarString
+	case []byte:
+		if len(vv) > SonarMaxLen {
+			return failure, 0
+		}
+		return uint8(copy(buf, vv)), SonarString
 	case [1]byte:
 		return uint8(copy(buf, vv[:])), SonarString
 	case [2]byte:
@@ -22,7 +22,7 @@ type FD syscall.Handle
 
 func setupCommFile() ([]byte, FD, FD) {
 	const (
-		size                = CoverSize + MaxInputSize + SonarRegionSize
+		size                = CommSize
 		FILE_MAP_ALL_ACCESS = 0xF001F
 	)
 	mapping := readEnvParam("GO_FUZZ_COMM_FD")
@@ -0,0 +1,193 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/rpc"
+	"os"
+	"time"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+// Master/slave connections can be protected with TLS (-tlscert/-tlskey/-tlsca)
+// and/or with a pre-shared token (-token). With TLS the master requires
+// client certificates signed by -tlsca (if given), and slaves verify
+// master certificate against -tlsca. The token is sent by slave right after
+// connection establishment (after TLS handshake) as 2-byte length + token,
+// master replies with a single byte (1 - accepted, 0 - rejected).
+
+const maxTokenLen = 1 << 10
+
+// token returns the pre-shared authentication token.
+func token() string {
+	if *flagToken != "" {
+		return *flagToken
+	}
+	return os.Getenv("GO_FUZZ_TOKEN")
+}
+
+// tlsConfig returns TLS config for master (server) or slave side of connection,
+// or nil if TLS is not enabled.
+func tlsConfig(server bool) *tls.Config {
+	if *flagTLSCert == "" && *flagTLSCA == "" {
+		return nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if *flagTLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(*flagTLSCert, *flagTLSKey)
+		if err != nil {
+			log.Fatalf("failed to load TLS certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	} else if server {
+		log.Fatalf("-tlscert is required for TLS in master mode")
+	}
+	if *flagTLSCA != "" {
+		data, err := ioutil.ReadFile(*flagTLSCA)
+		if err != nil {
+			log.Fatalf("failed to read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			log.Fatalf("failed to parse CA certificate %v", *flagTLSCA)
+		}
+		if server {
+			cfg.ClientCAs = pool
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			cfg.RootCAs = pool
+		}
+	}
+	return cfg
+}
+
+// masterServe accepts and authenticates slave connections.
+func masterServe(ln net.Listener, s *rpc.Server) {
+	if cfg := tlsConfig(true); cfg != nil {
+		ln = tls.NewListener(ln, cfg)
+	}
+	tok := token()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("failed to accept connection: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		go func() {
+			if tok != "" {
+				if err := checkToken(conn, tok); err != nil {
+					log.Printf("rejected connection from %v: %v", conn.RemoteAddr(), err)
+					conn.Close()
+					return
+				}
+			}
+			s.ServeConn(conn)
+		}()
+	}
+}
+
+func checkToken(conn net.Conn, tok string) error {
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+	var n uint16
+	if err := binary.Read(conn, binary.LittleEndian, &n); err != nil {
+		return err
+	}
+	if n > maxTokenLen {
+		return errors.New("bad token")
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(buf, []byte(tok)) != 1 {
+		conn.Write([]byte{0})
+		return errors.New("bad token")
+	}
+	_, err := conn.Write([]byte{1})
+	return err
+}
+
+// dialMaster establishes authenticated connection to master.
+func dialMaster(addr string) (*rpc.Client, error) {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if cfg := tlsConfig(false); cfg != nil {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			cfg.ServerName = host
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, cfg)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tok := token(); tok != "" {
+		if len(tok) > maxTokenLen {
+			log.Fatalf("token is too long")
+		}
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		binary.Write(conn, binary.LittleEndian, uint16(len(tok)))
+		io.WriteString(conn, tok)
+		var reply [1]byte
+		if _, err := io.ReadFull(conn, reply[:]); err != nil || reply[0] != 1 {
+			conn.Close()
+			return nil, errors.New("master rejected the token")
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return rpc.NewClient(conn), nil
+}
+
+// metadataHash identifies instrumented binary. Slaves with binaries that
+// differ from master's binary would corrupt corpus (e.g. coverage is
+// different), so master rejects them.
+func metadataHash(metadata MetaData) Sig {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		log.Fatalf("failed to serialize metadata: %v", err)
+	}
+	return hash(data)
+}
+
+// loadMetadata reads metadata from the archive produced by go-fuzz-build.
+func loadMetadata(bin string) MetaData {
+	zipr, err := zip.OpenReader(bin)
+	if err != nil {
+		log.Fatalf("failed to open bin file: %v", err)
+	}
+	defer zipr.Close()
+	for _, zipf := range zipr.File {
+		if zipf.Name != "metadata" {
+			continue
+		}
+		r, err := zipf.Open()
+		if err != nil {
+			log.Fatalf("failed to uzip file from input archive: %v", err)
+		}
+		defer r.Close()
+		var metadata MetaData
+		if err := json.NewDecoder(r).Decode(&metadata); err != nil {
+			log.Fatalf("failed to decode metadata: %v", err)
+		}
+		return metadata
+	}
+	log.Fatalf("bad input archive: missing metadata")
+	return MetaData{}
+}
@@ -5532,115 +5532,123 @@ func assets_jquery_min_js() ([]byte, error) {
 
 func assets_stats_html() ([]byte, error) {
 	return bindata_read([]byte{
-		0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x00, 0xff, 0xbc, 0x57,
-		0x6d, 0x6f, 0xdb, 0x36, 0x10, 0xfe, 0x6c, 0xfd, 0x8a, 0x8b, 0x3a, 0xc0,
-		0x32, 0x1a, 0x49, 0x71, 0x9a, 0x0e, 0x45, 0xea, 0x78, 0x1b, 0x52, 0x77,
-		0xcb, 0xd0, 0x37, 0xcc, 0xd9, 0x86, 0x61, 0xdd, 0x07, 0x5a, 0x3a, 0x5b,
-		0x6c, 0x24, 0x51, 0x23, 0x29, 0xbb, 0x6e, 0xe0, 0xff, 0xbe, 0x23, 0x25,
-		0x39, 0x92, 0x53, 0xb7, 0xf3, 0x30, 0x04, 0x08, 0x1c, 0xf2, 0xee, 0xb9,
-		0xe3, 0x73, 0x77, 0x24, 0x8f, 0x1a, 0x1d, 0xbd, 0x78, 0x7b, 0x79, 0xfd,
-		0xc7, 0xbb, 0x09, 0x24, 0x3a, 0x4b, 0xc7, 0xce, 0xa8, 0xfe, 0x97, 0xf2,
-		0xfc, 0x06, 0x24, 0xa6, 0x17, 0xae, 0xd2, 0xeb, 0x14, 0x55, 0x82, 0xa8,
-		0x5d, 0x48, 0x24, 0xce, 0x2f, 0xdc, 0x70, 0x26, 0x84, 0x56, 0x5a, 0xb2,
-		0x22, 0xc8, 0x78, 0x1e, 0x44, 0x4a, 0xb9, 0xff, 0xda, 0xc2, 0xd7, 0x09,
-		0x66, 0xd8, 0xb2, 0x73, 0x46, 0x33, 0x11, 0xaf, 0xc7, 0x0e, 0xc0, 0x28,
-		0xe6, 0x4b, 0x88, 0x52, 0xa6, 0xd4, 0x85, 0x1b, 0x89, 0x5c, 0x33, 0x9e,
-		0xa3, 0xf4, 0xe7, 0x69, 0xc9, 0x63, 0xd7, 0xe8, 0xbb, 0x08, 0x29, 0x56,
-		0xb5, 0x74, 0xd7, 0x32, 0xf5, 0x55, 0xe6, 0x0f, 0x4f, 0xc1, 0x8c, 0xb2,
-		0xd8, 0x8c, 0x32, 0x72, 0xb5, 0x05, 0x13, 0x3c, 0x19, 0x36, 0xe8, 0x82,
-		0x2d, 0xd0, 0x4f, 0x90, 0xc5, 0x28, 0xdd, 0xf1, 0x8f, 0x02, 0x5e, 0x96,
-		0x9f, 0x3e, 0x8d, 0xc2, 0x64, 0xd8, 0x02, 0x77, 0xd7, 0x84, 0x22, 0x65,
-		0x11, 0x26, 0x22, 0x25, 0x0b, 0xd5, 0xf2, 0x79, 0x9f, 0xc4, 0x47, 0xe5,
-		0x3f, 0x81, 0x86, 0x4d, 0xdb, 0xac, 0x63, 0x65, 0xd8, 0x9c, 0x01, 0x8f,
-		0x29, 0x6b, 0x29, 0x5b, 0x22, 0xb9, 0xa4, 0xe5, 0xcf, 0x76, 0x10, 0xaa,
-		0x60, 0x79, 0xe3, 0x5a, 0xe3, 0x47, 0xed, 0x67, 0xa5, 0x46, 0x4a, 0xca,
-		0xd4, 0x9a, 0x8c, 0x42, 0xa3, 0xef, 0x50, 0x09, 0x89, 0xcb, 0xff, 0xc9,
-		0x2d, 0x12, 0xb2, 0x28, 0x0f, 0xe3, 0x76, 0x69, 0x4d, 0x1e, 0x82, 0x9b,
-		0x64, 0xb4, 0xd7, 0xe4, 0x81, 0xec, 0x6a, 0xa3, 0x07, 0xe0, 0x27, 0x51,
-		0x69, 0x26, 0xf5, 0x61, 0xfc, 0x7e, 0xa9, 0x8d, 0xfe, 0x1b, 0xbf, 0xb3,
-		0x43, 0xf8, 0xe1, 0x47, 0x8c, 0x0e, 0x23, 0x37, 0x31, 0x16, 0x0f, 0xc0,
-		0x2c, 0x12, 0x4b, 0xa3, 0x3b, 0x68, 0xd3, 0x91, 0xc5, 0x03, 0x30, 0x2b,
-		0x0b, 0xcd, 0x33, 0x3c, 0x88, 0xda, 0xaf, 0xd6, 0xe4, 0xab, 0xdc, 0xea,
-		0x69, 0xeb, 0xae, 0x3a, 0x6d, 0xbc, 0xa9, 0x72, 0xb6, 0xbd, 0xaa, 0x7e,
-		0xe2, 0x4a, 0x0b, 0xb9, 0xa6, 0xf5, 0x4f, 0x3f, 0x7f, 0x55, 0x69, 0x36,
-		0x4b, 0xd1, 0xa7, 0xbd, 0x57, 0x88, 0x5c, 0xf1, 0x25, 0x76, 0xaf, 0x2a,
-		0xab, 0xed, 0x40, 0xa1, 0x32, 0xa0, 0x3b, 0x9a, 0x17, 0x18, 0xef, 0x86,
-		0xad, 0xcd, 0xba, 0x5d, 0x99, 0x91, 0xca, 0x5d, 0x91, 0x85, 0x6e, 0xaf,
-		0x25, 0x1a, 0x7e, 0x56, 0xdf, 0x5c, 0x0d, 0x7b, 0xf5, 0xdb, 0xc3, 0xb9,
-		0x0f, 0x71, 0x77, 0x3c, 0xf6, 0x21, 0xea, 0x3d, 0xba, 0x9f, 0x82, 0xdd,
-		0x28, 0xfb, 0xd4, 0x4d, 0xb1, 0xee, 0xeb, 0x49, 0xb6, 0x13, 0xb5, 0x41,
-		0xd9, 0xec, 0xf4, 0x2a, 0x6b, 0xdb, 0xce, 0x48, 0x58, 0xb5, 0xb5, 0x9e,
-		0x05, 0x98, 0xdc, 0xde, 0xab, 0xf1, 0xbd, 0xc9, 0x76, 0x58, 0x0f, 0x9a,
-		0xbd, 0xe0, 0x8c, 0x54, 0x44, 0x65, 0xd1, 0xa0, 0x64, 0x44, 0xbd, 0xf4,
-		0xc3, 0xdf, 0x25, 0xca, 0xb5, 0x6d, 0xa1, 0x1f, 0xec, 0xc1, 0xad, 0xb4,
-		0xe3, 0x1d, 0x58, 0xb7, 0x49, 0x77, 0x91, 0xe4, 0xf2, 0xc8, 0xf7, 0xe1,
-		0x3a, 0x41, 0x98, 0x8b, 0x34, 0x15, 0x2b, 0x9e, 0x2f, 0x68, 0xeb, 0x9a,
-		0xbe, 0x3d, 0x06, 0x96, 0xc7, 0x50, 0xbb, 0x1a, 0xc3, 0x2c, 0x15, 0xd1,
-		0x8d, 0x82, 0x95, 0x90, 0x37, 0xc0, 0xa4, 0x28, 0x49, 0xc7, 0x40, 0x15,
-		0x18, 0xf1, 0x39, 0x8f, 0x60, 0x56, 0x2e, 0x60, 0xc5, 0x75, 0x42, 0x3f,
-		0xb1, 0x4e, 0x1c, 0x9e, 0xc3, 0xd5, 0x04, 0x86, 0x27, 0x40, 0x83, 0xdf,
-		0x79, 0x1e, 0x8b, 0x95, 0x82, 0x67, 0xd6, 0x5f, 0x33, 0x7b, 0x97, 0x88,
-		0x1c, 0xe1, 0x59, 0x00, 0x53, 0xc4, 0x73, 0x27, 0xd1, 0xba, 0x38, 0x0f,
-		0xc3, 0x05, 0xea, 0x3b, 0xb2, 0x91, 0xc8, 0x8c, 0x40, 0x13, 0x23, 0xdf,
-		0x16, 0x19, 0xe3, 0xf0, 0x91, 0x2a, 0x8b, 0x42, 0x48, 0xed, 0x73, 0x1c,
-		0x9e, 0xf8, 0x76, 0x2d, 0xf0, 0x7d, 0x13, 0xb0, 0x65, 0xec, 0x7c, 0xef,
-		0xaf, 0x70, 0x76, 0xc3, 0xb5, 0xbf, 0xe4, 0xb8, 0x32, 0x40, 0x4a, 0xe6,
-		0x6d, 0xc5, 0xe9, 0x1c, 0x62, 0x5c, 0xf2, 0x08, 0x2b, 0xab, 0xe7, 0xb0,
-		0x21, 0x70, 0x26, 0x3e, 0xb5, 0x91, 0x5f, 0x01, 0xab, 0x1d, 0xec, 0x97,
-		0xc0, 0x62, 0x17, 0xfb, 0x05, 0xf0, 0x2e, 0xf2, 0x4b, 0x60, 0xaa, 0x5c,
-		0x15, 0x69, 0x53, 0x17, 0x27, 0x0c, 0xe1, 0x52, 0x14, 0x6b, 0xc9, 0x17,
-		0x89, 0x86, 0xd3, 0x93, 0xe1, 0x99, 0x4f, 0x3f, 0x4f, 0xe1, 0x9a, 0xaa,
-		0xa1, 0x51, 0x1e, 0xc3, 0x55, 0x1e, 0x05, 0x06, 0xf4, 0x8a, 0xfc, 0xe4,
-		0x0a, 0x63, 0xa0, 0xca, 0xa1, 0x84, 0xd7, 0x57, 0xd7, 0xe0, 0x99, 0xb4,
-		0x2b, 0x93, 0x77, 0xaa, 0x5c, 0x39, 0xb3, 0x19, 0xd7, 0xab, 0x99, 0xba,
-		0xdb, 0x31, 0x21, 0x55, 0x7d, 0x16, 0x66, 0x4c, 0x91, 0xab, 0xf0, 0xd5,
-		0xd5, 0xe5, 0xe4, 0xcd, 0x74, 0x32, 0x70, 0xf8, 0x1c, 0xbc, 0x9c, 0x2d,
-		0xf9, 0x82, 0xd1, 0xd5, 0x13, 0x94, 0x0a, 0xe5, 0x0f, 0x0b, 0xcc, 0x75,
-		0x90, 0x31, 0x1d, 0x25, 0x5e, 0x78, 0x35, 0x79, 0x2d, 0x66, 0x3c, 0xc5,
-		0xf7, 0xe1, 0xf0, 0xe4, 0x7d, 0x70, 0x12, 0x0e, 0x06, 0x70, 0xeb, 0xf4,
-		0x96, 0x4c, 0x42, 0xa6, 0x7e, 0xab, 0x63, 0x9d, 0x9a, 0x28, 0xe0, 0x02,
-		0x62, 0x11, 0x95, 0x99, 0xb1, 0x8d, 0x24, 0x32, 0x8d, 0x93, 0x14, 0xcd,
-		0xcc, 0xeb, 0xdb, 0x28, 0xfb, 0x03, 0xa7, 0xb7, 0x63, 0x12, 0xb0, 0xa2,
-		0xc0, 0x3c, 0xbe, 0x4c, 0x78, 0x1a, 0x7b, 0x4e, 0xaf, 0xb7, 0x63, 0x7f,
-		0x4d, 0xf7, 0xec, 0x1b, 0x11, 0xa3, 0x51, 0xf5, 0xfa, 0x9d, 0x9a, 0xdd,
-		0x56, 0x19, 0x65, 0xa5, 0x16, 0x47, 0x3c, 0x33, 0x12, 0x96, 0xeb, 0x4d,
-		0x9f, 0x80, 0xb4, 0x0a, 0xfd, 0x6d, 0x3d, 0xd9, 0x43, 0x35, 0xc5, 0x14,
-		0x23, 0x8a, 0xce, 0xeb, 0x9b, 0x23, 0xdd, 0x1f, 0x74, 0xd6, 0xdd, 0xe1,
-		0x34, 0x70, 0x6c, 0x5d, 0x9a, 0x13, 0xd5, 0xae, 0xcc, 0x4b, 0x2e, 0x95,
-		0x3e, 0x86, 0x28, 0x41, 0x73, 0x76, 0x28, 0x6f, 0x5c, 0x03, 0x57, 0x79,
-		0x9f, 0x7e, 0xb3, 0xa2, 0x8a, 0x95, 0x2a, 0xb2, 0x46, 0x1d, 0xd8, 0xa4,
-		0x1e, 0x4d, 0xe9, 0xd6, 0xcd, 0x17, 0x41, 0x21, 0x85, 0x16, 0x7a, 0x5d,
-		0x60, 0x30, 0x17, 0x92, 0xb2, 0x6a, 0x13, 0xb8, 0x47, 0x47, 0x49, 0x9c,
-		0x97, 0x79, 0xa4, 0xb9, 0xc8, 0x3d, 0x8b, 0xb3, 0x99, 0x66, 0x72, 0xa1,
-		0x48, 0x43, 0xff, 0x6c, 0x50, 0xea, 0x39, 0xc9, 0x25, 0xea, 0x52, 0xe6,
-		0xa0, 0x13, 0xae, 0x02, 0x89, 0xb6, 0xb7, 0x79, 0xe1, 0xad, 0xf7, 0x3e,
-		0x7e, 0x3c, 0xd8, 0x84, 0x8b, 0xe3, 0x3b, 0x37, 0xb6, 0x8e, 0xc7, 0x90,
-		0x97, 0xd9, 0x0c, 0x25, 0xf9, 0x04, 0x93, 0xcd, 0xc6, 0x9a, 0x56, 0x16,
-		0x73, 0xeb, 0xff, 0xcf, 0x0a, 0xf0, 0x17, 0x1c, 0x5d, 0x40, 0xdf, 0xec,
-		0xaa, 0x39, 0xbd, 0xd3, 0x63, 0x93, 0xd1, 0xde, 0x77, 0x1d, 0x80, 0x91,
-		0x9c, 0x83, 0xf5, 0x6a, 0x86, 0x86, 0xcb, 0x66, 0x40, 0xbf, 0x9b, 0xe7,
-		0x94, 0x39, 0xc7, 0xd0, 0xa5, 0xf7, 0xf4, 0xcb, 0xcc, 0x84, 0xe2, 0x9a,
-		0x5e, 0x32, 0xd2, 0xf1, 0xf8, 0xf6, 0x64, 0x43, 0xd7, 0x65, 0x5c, 0x8d,
-		0x87, 0xad, 0xf1, 0x69, 0x6b, 0xfc, 0xa4, 0x35, 0x3e, 0x6b, 0x8d, 0x9f,
-		0xb6, 0xc6, 0xdf, 0xd6, 0x63, 0x73, 0x5d, 0xbb, 0xd5, 0x6a, 0xb8, 0xd4,
-		0x53, 0x51, 0xca, 0xc8, 0x6c, 0xc0, 0x1c, 0x57, 0x30, 0x59, 0x52, 0x8a,
-		0x2a, 0x89, 0xe7, 0x86, 0x68, 0x66, 0xca, 0xce, 0x5c, 0x62, 0xb9, 0x05,
-		0x07, 0x2c, 0x8e, 0x2d, 0xf2, 0x15, 0xb5, 0x5c, 0xa4, 0x2f, 0x12, 0xcf,
-		0x2d, 0xa8, 0x20, 0x6e, 0x2b, 0x71, 0xb8, 0xdd, 0xe9, 0x31, 0xd3, 0x8c,
-		0xbc, 0xff, 0x3c, 0x7d, 0xfb, 0x26, 0x28, 0x98, 0x54, 0xe8, 0x61, 0x60,
-		0x64, 0x26, 0xec, 0x6f, 0x3c, 0xd7, 0xf6, 0x04, 0x77, 0x40, 0xc5, 0x44,
-		0xb3, 0xad, 0xbc, 0x2a, 0xfe, 0xba, 0xa2, 0x76, 0x5f, 0x13, 0x36, 0xa8,
-		0xda, 0xe7, 0x71, 0x33, 0xad, 0xba, 0xe5, 0xdd, 0xb4, 0x6e, 0x8e, 0x46,
-		0xe0, 0x0e, 0x43, 0x17, 0x1e, 0xdb, 0x55, 0x83, 0xa6, 0x25, 0xbe, 0xc0,
-		0x5c, 0x64, 0x5b, 0xb4, 0x6d, 0x83, 0x2d, 0x57, 0xd4, 0xf5, 0xb6, 0xb3,
-		0xaa, 0xc9, 0xd1, 0x29, 0x20, 0x76, 0x96, 0xde, 0xa3, 0xfa, 0x13, 0x64,
-		0x10, 0x98, 0x87, 0x8b, 0xd7, 0x22, 0x33, 0xa8, 0xf4, 0xf5, 0x67, 0x40,
-		0x5b, 0x5f, 0xb1, 0x6b, 0xf4, 0xcd, 0x53, 0xbc, 0x83, 0xa8, 0x85, 0x35,
-		0x66, 0xfb, 0x1c, 0xae, 0x31, 0x7b, 0x63, 0xa8, 0xf1, 0xd5, 0xf3, 0xb4,
-		0xed, 0xd0, 0xc6, 0xb4, 0x65, 0x64, 0x9e, 0x88, 0x5d, 0x42, 0x24, 0xa9,
-		0xb5, 0xf5, 0x33, 0xad, 0xad, 0xae, 0x82, 0xa6, 0xb3, 0x6b, 0x82, 0x6e,
-		0xb5, 0xce, 0xb0, 0x6a, 0xd7, 0xf4, 0xa0, 0xb2, 0xdf, 0xbf, 0xff, 0x04,
-		0x00, 0x00, 0xff, 0xff, 0x03, 0x82, 0xc6, 0xa5, 0x17, 0x0f, 0x00, 0x00,
+		0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbd, 0x58,
+		0x6d, 0x6f, 0xdb, 0x36, 0x10, 0xfe, 0x6c, 0xff, 0x8a, 0x8b, 0x3a, 0xc0,
+		0x12, 0x1a, 0x49, 0x71, 0x9a, 0x0e, 0x45, 0xea, 0x78, 0x1b, 0x52, 0x77,
+		0xcb, 0xd0, 0x37, 0xcc, 0xd9, 0x86, 0xa1, 0xed, 0x07, 0x5a, 0x3a, 0x5b,
+		0x6c, 0x24, 0x51, 0x23, 0x29, 0xbb, 0x6e, 0x9a, 0xff, 0xbe, 0x23, 0x25,
+		0x39, 0x92, 0x53, 0xb7, 0xf3, 0x30, 0x04, 0x08, 0x64, 0xf2, 0xee, 0xb9,
+		0xe3, 0xc3, 0x3b, 0x92, 0x47, 0x66, 0x74, 0xf0, 0xec, 0xf5, 0xf9, 0xe5,
+		0x5f, 0x6f, 0x26, 0x90, 0xe8, 0x2c, 0x1d, 0xf7, 0x47, 0xf5, 0x4f, 0xca,
+		0xf3, 0x2b, 0x90, 0x98, 0x9e, 0x39, 0x4a, 0xaf, 0x53, 0x54, 0x09, 0xa2,
+		0x76, 0x20, 0x91, 0x38, 0x3f, 0x73, 0xc2, 0x99, 0x10, 0x5a, 0x69, 0xc9,
+		0x8a, 0x20, 0xe3, 0x79, 0x10, 0x29, 0xe5, 0xfc, 0x6b, 0x0b, 0x5f, 0x27,
+		0x98, 0x61, 0xcb, 0xae, 0x3f, 0x9a, 0x89, 0x78, 0x3d, 0xee, 0x03, 0x8c,
+		0x62, 0xbe, 0x84, 0x28, 0x65, 0x4a, 0x9d, 0x39, 0x91, 0xc8, 0x35, 0xe3,
+		0x39, 0x4a, 0x7f, 0x9e, 0x96, 0x3c, 0x76, 0x8c, 0xbe, 0x8b, 0x90, 0x62,
+		0x55, 0x4b, 0xb7, 0x2d, 0x53, 0x5f, 0x65, 0xfe, 0xf0, 0x18, 0x4c, 0x2b,
+		0x8b, 0x4d, 0x2b, 0x23, 0x57, 0x1b, 0x30, 0xc1, 0x93, 0x61, 0x83, 0x2e,
+		0xd8, 0x02, 0xfd, 0x04, 0x59, 0x8c, 0xd2, 0x19, 0xff, 0x2c, 0xe0, 0x79,
+		0xf9, 0xe9, 0x13, 0x8c, 0x54, 0xc6, 0xd2, 0x74, 0x3c, 0x62, 0x0d, 0xfb,
+		0x48, 0x2c, 0x8d, 0xde, 0xfe, 0x90, 0xc1, 0x28, 0x64, 0xe3, 0x51, 0x58,
+		0x83, 0xc2, 0x64, 0xd8, 0xf2, 0xdc, 0x25, 0x08, 0x45, 0xca, 0x22, 0x4c,
+		0x44, 0x4a, 0xee, 0x55, 0x8b, 0xc0, 0x5d, 0xc6, 0x1f, 0x95, 0xff, 0x08,
+		0x1a, 0xea, 0x6d, 0xb3, 0x8e, 0x95, 0xa1, 0x7e, 0x02, 0x3c, 0xa6, 0x10,
+		0xa7, 0x6c, 0x89, 0xe4, 0x92, 0x86, 0x3f, 0xd9, 0x42, 0xa8, 0x82, 0xe5,
+		0x8d, 0x6b, 0x8d, 0x1f, 0xb5, 0x9f, 0x95, 0x1a, 0x29, 0x82, 0x53, 0x6b,
+		0x42, 0xbc, 0x49, 0xdf, 0xa1, 0x12, 0x12, 0x97, 0xff, 0x93, 0x5b, 0x24,
+		0x64, 0x51, 0xee, 0xc7, 0xed, 0xdc, 0x9a, 0xdc, 0x07, 0x37, 0xc9, 0x68,
+		0x61, 0xca, 0x3d, 0xd9, 0xd5, 0x46, 0xf7, 0xc0, 0x4f, 0xa5, 0x66, 0x59,
+		0xef, 0x95, 0x55, 0xb1, 0xba, 0x07, 0x5e, 0x12, 0x95, 0x66, 0x52, 0xef,
+		0x17, 0xb7, 0xdf, 0x6a, 0xa3, 0xff, 0xc6, 0xef, 0x64, 0x1f, 0x7e, 0xf8,
+		0x11, 0xa3, 0xfd, 0xc8, 0x4d, 0x8c, 0xc5, 0x3d, 0x30, 0xab, 0xcf, 0x8e,
+		0xbd, 0x36, 0x03, 0x59, 0xdc, 0x03, 0xb3, 0x98, 0x47, 0x7a, 0x2f, 0x62,
+		0xcf, 0xc8, 0xe0, 0x1e, 0x78, 0xa9, 0x28, 0xc1, 0xb8, 0x4c, 0x71, 0xbf,
+		0x7d, 0x50, 0x1b, 0xdd, 0x03, 0xbf, 0xb2, 0xd0, 0x3c, 0xdb, 0x8f, 0xdd,
+		0xef, 0xd6, 0xe4, 0x9b, 0xdc, 0xea, 0x6e, 0xab, 0x50, 0x1d, 0x37, 0xde,
+		0x54, 0x39, 0xdb, 0xd4, 0xa9, 0x5f, 0xb8, 0xd2, 0x42, 0xae, 0x69, 0xfc,
+		0xe3, 0x2f, 0x97, 0x1e, 0xcd, 0x66, 0x29, 0xfa, 0xb4, 0x67, 0x0b, 0x91,
+		0x2b, 0xbe, 0xc4, 0x6e, 0xe9, 0xb1, 0xda, 0x0e, 0x14, 0x2a, 0x03, 0x2a,
+		0xd0, 0xbc, 0xc0, 0x78, 0x7b, 0xda, 0xda, 0x8c, 0xdb, 0x95, 0x19, 0xa9,
+		0xdc, 0x16, 0x59, 0xe8, 0xa6, 0xcc, 0x50, 0xf3, 0x8b, 0xfa, 0xe6, 0xa8,
+		0xdf, 0xa9, 0xdf, 0x1c, 0xb6, 0xbb, 0x10, 0xb7, 0xc7, 0xca, 0x2e, 0x44,
+		0xbd, 0xb7, 0x77, 0x53, 0xb0, 0x1b, 0x6c, 0x97, 0xba, 0x49, 0xd6, 0x5d,
+		0x3d, 0xc9, 0xb6, 0x66, 0x6d, 0x50, 0x36, 0x3a, 0xbd, 0xca, 0xda, 0xde,
+		0x65, 0x48, 0x58, 0xdd, 0x69, 0x7a, 0x16, 0x60, 0x62, 0x7b, 0x27, 0xc7,
+		0x77, 0x3a, 0x9b, 0x66, 0xdd, 0x68, 0xd6, 0x42, 0x7f, 0xa4, 0x22, 0x4a,
+		0x8b, 0x06, 0x25, 0x23, 0xba, 0x8a, 0x7c, 0xf8, 0xbb, 0x44, 0xb9, 0xb6,
+		0xf7, 0xa7, 0x0f, 0xf6, 0xc0, 0xab, 0xb4, 0xe3, 0x2d, 0x58, 0xf7, 0x86,
+		0xd6, 0x45, 0x92, 0xcb, 0x03, 0xdf, 0x87, 0xcb, 0x04, 0x61, 0x2e, 0x52,
+		0xaa, 0x1f, 0x3c, 0x5f, 0xd0, 0xd2, 0x35, 0x97, 0xb6, 0x31, 0xb0, 0x3c,
+		0x86, 0xda, 0xd5, 0x18, 0x66, 0xa9, 0x88, 0xae, 0x14, 0xac, 0x84, 0xbc,
+		0x02, 0x26, 0x45, 0x49, 0x3a, 0x06, 0xaa, 0xc0, 0x88, 0xcf, 0x79, 0x04,
+		0xb3, 0x72, 0x01, 0x2b, 0xae, 0x13, 0xfa, 0xc4, 0x3a, 0xe9, 0xf3, 0x1c,
+		0x2e, 0x26, 0x30, 0x3c, 0x02, 0x6a, 0xfc, 0xc9, 0xf3, 0x58, 0xac, 0x14,
+		0x3c, 0xb1, 0xfe, 0x9a, 0xde, 0x9b, 0x44, 0xe4, 0x08, 0x4f, 0x02, 0x98,
+		0x22, 0x9e, 0xf6, 0x13, 0xad, 0x8b, 0xd3, 0x30, 0x5c, 0xa0, 0xbe, 0x25,
+		0x1b, 0x89, 0xcc, 0x08, 0x34, 0x31, 0xf2, 0x6d, 0x92, 0x31, 0x0e, 0x1f,
+		0xa8, 0xb2, 0x28, 0x84, 0xd4, 0x3e, 0xc7, 0xe1, 0x91, 0x6f, 0xc7, 0x02,
+		0xdf, 0x37, 0x13, 0xb6, 0x8c, 0xfb, 0x3f, 0xfa, 0x2b, 0x9c, 0x5d, 0x71,
+		0xed, 0x2f, 0x39, 0xae, 0x0c, 0x90, 0x82, 0x79, 0x5d, 0x71, 0x3a, 0x85,
+		0x18, 0x97, 0x3c, 0xc2, 0xca, 0xea, 0x29, 0xdc, 0x10, 0x38, 0x13, 0x9f,
+		0xda, 0xc8, 0x6f, 0x80, 0xd5, 0x16, 0xf6, 0x6b, 0x60, 0xb1, 0x8d, 0xfd,
+		0x0a, 0x78, 0x1b, 0xf9, 0x35, 0x30, 0x65, 0xae, 0x9a, 0x69, 0x93, 0x97,
+		0x7e, 0x18, 0xc2, 0xb9, 0x28, 0xd6, 0x92, 0x2f, 0x12, 0x0d, 0xc7, 0x47,
+		0xc3, 0x13, 0x9f, 0x3e, 0x8f, 0xe1, 0x92, 0xb2, 0xa1, 0x51, 0x1e, 0xc2,
+		0x45, 0x1e, 0x05, 0x06, 0xf4, 0x82, 0xfc, 0xe4, 0x0a, 0x63, 0xa0, 0xcc,
+		0xa1, 0x84, 0x97, 0x17, 0x97, 0xe0, 0x9a, 0xb0, 0x2b, 0x13, 0x77, 0xca,
+		0x5c, 0x39, 0xb3, 0x11, 0xd7, 0xab, 0x99, 0xba, 0x5d, 0x31, 0x21, 0x65,
+		0x7d, 0x16, 0x66, 0x4c, 0x91, 0xab, 0xf0, 0xc5, 0xc5, 0xf9, 0xe4, 0xd5,
+		0x74, 0xe2, 0xf5, 0xf9, 0x1c, 0xdc, 0x9c, 0x2d, 0xf9, 0x82, 0xd1, 0xd1,
+		0x13, 0x94, 0x0a, 0xe5, 0x4f, 0x0b, 0xcc, 0x75, 0x90, 0x31, 0x1d, 0x25,
+		0x6e, 0x78, 0x31, 0x79, 0x29, 0x66, 0x3c, 0xc5, 0x77, 0xe1, 0xf0, 0xe8,
+		0x5d, 0x70, 0x14, 0x7a, 0x1e, 0x5c, 0xf7, 0x7b, 0x4b, 0x26, 0x21, 0x53,
+		0x7f, 0xd4, 0x73, 0x9d, 0x9a, 0x59, 0xc0, 0x19, 0xc4, 0x22, 0x2a, 0x33,
+		0x63, 0x1b, 0x49, 0x64, 0x1a, 0x27, 0x29, 0x9a, 0x9e, 0x3b, 0xb0, 0xb3,
+		0x1c, 0x78, 0xfd, 0xde, 0x96, 0x49, 0xc0, 0x8a, 0x02, 0xf3, 0xf8, 0x3c,
+		0xe1, 0x69, 0xec, 0xf6, 0x7b, 0xbd, 0x2d, 0xfb, 0x4b, 0x3a, 0x67, 0x5f,
+		0x89, 0x18, 0x8d, 0xaa, 0x37, 0xe8, 0xe4, 0xec, 0xba, 0x8a, 0x28, 0x2b,
+		0xb5, 0x38, 0xe0, 0x99, 0x91, 0xb0, 0x5c, 0xdf, 0x0c, 0x08, 0x48, 0xa3,
+		0xd0, 0xdf, 0xc6, 0x93, 0xdd, 0x54, 0x53, 0x4c, 0x31, 0xa2, 0xd9, 0xb9,
+		0x03, 0xb3, 0xa5, 0x07, 0x5e, 0x67, 0xdc, 0x2d, 0x4e, 0x5e, 0xdf, 0xe6,
+		0xa5, 0xd9, 0x51, 0xed, 0xcc, 0x3c, 0xe7, 0x52, 0xe9, 0x43, 0xa0, 0x7a,
+		0x64, 0xf6, 0x0e, 0xc5, 0x8d, 0x6b, 0xe0, 0x2a, 0x1f, 0xd0, 0x37, 0x2b,
+		0xaa, 0xb9, 0x52, 0x46, 0xd6, 0xa8, 0x03, 0x1b, 0xd4, 0x83, 0x29, 0x9d,
+		0xba, 0xf9, 0x22, 0x28, 0xa4, 0xd0, 0x42, 0xaf, 0x0b, 0x0c, 0xe6, 0x42,
+		0x52, 0x54, 0x6d, 0x00, 0x77, 0xe8, 0x28, 0x88, 0xf3, 0x32, 0x8f, 0x34,
+		0x17, 0xb9, 0x6b, 0x71, 0x36, 0xd2, 0x4c, 0x2e, 0x14, 0x69, 0xe8, 0xc7,
+		0x4e, 0x4a, 0x3d, 0x25, 0xb9, 0x44, 0x5d, 0xca, 0x1c, 0x74, 0xc2, 0x55,
+		0x20, 0xd1, 0xd6, 0x36, 0x37, 0xbc, 0x76, 0xdf, 0xc5, 0x0f, 0xbd, 0x9b,
+		0x70, 0x71, 0x78, 0xeb, 0xc6, 0xe6, 0xf1, 0x10, 0xf2, 0x32, 0x9b, 0xa1,
+		0x24, 0x9f, 0x60, 0xa2, 0xd9, 0x58, 0xd3, 0xc8, 0x62, 0x6e, 0xfd, 0xbf,
+		0xad, 0x00, 0xef, 0xe1, 0xe0, 0x0c, 0x06, 0x66, 0x55, 0xcd, 0xe9, 0x91,
+		0x16, 0x9b, 0x88, 0xf6, 0x7e, 0xe8, 0x00, 0x8c, 0xe4, 0x14, 0xac, 0x57,
+		0xd3, 0x34, 0x5c, 0x6e, 0x3c, 0xfa, 0xde, 0x3c, 0xa5, 0xc8, 0xf5, 0x0d,
+		0x5d, 0x7a, 0x1f, 0x3d, 0xcf, 0xcc, 0x54, 0x1c, 0x53, 0x4b, 0x46, 0x3a,
+		0x1e, 0x5f, 0x1f, 0xdd, 0xd0, 0x71, 0x19, 0x57, 0xed, 0x61, 0xab, 0x7d,
+		0xdc, 0x6a, 0x3f, 0x6a, 0xb5, 0x4f, 0x5a, 0xed, 0xc7, 0xad, 0xf6, 0xf7,
+		0x75, 0xdb, 0x1c, 0xd7, 0x4e, 0x35, 0x1a, 0x2e, 0xf5, 0x54, 0x94, 0x32,
+		0x32, 0x0b, 0x30, 0xc7, 0x15, 0x4c, 0x96, 0x14, 0xa2, 0x4a, 0xe2, 0x3a,
+		0x21, 0x9a, 0x9e, 0xb2, 0x3d, 0x87, 0x58, 0x6e, 0xc0, 0x01, 0x8b, 0x63,
+		0x8b, 0x7c, 0x41, 0x25, 0x17, 0xe9, 0x39, 0xea, 0x3a, 0x05, 0x25, 0xc4,
+		0x69, 0x05, 0x0e, 0x37, 0x2b, 0x3d, 0x66, 0x9a, 0x91, 0xf7, 0x5f, 0xa7,
+		0xaf, 0x5f, 0x05, 0x05, 0x93, 0x0a, 0x5d, 0x0c, 0x8c, 0xcc, 0x4c, 0xfb,
+		0x3b, 0xd7, 0xb1, 0x35, 0xc1, 0xf1, 0x28, 0x99, 0x68, 0x96, 0x95, 0x5b,
+		0xcd, 0xbf, 0xce, 0xa8, 0x5d, 0xd7, 0x84, 0x0d, 0xaa, 0xf2, 0x79, 0xd8,
+		0x74, 0xab, 0x6a, 0x79, 0xdb, 0xad, 0x8b, 0xa3, 0x11, 0x38, 0xc3, 0xd0,
+		0x81, 0x87, 0x76, 0xd4, 0xa0, 0x29, 0x89, 0xcf, 0x30, 0x17, 0xd9, 0x06,
+		0x6d, 0xcb, 0x60, 0xcb, 0x15, 0x55, 0xbd, 0x4d, 0xaf, 0x2a, 0x72, 0xb4,
+		0x0b, 0x88, 0x9d, 0xa5, 0xf7, 0xa0, 0x7e, 0x52, 0x7a, 0x81, 0xb9, 0xb8,
+		0xb8, 0x2d, 0x32, 0x5e, 0xa5, 0xaf, 0x9f, 0x75, 0x6d, 0x7d, 0xc5, 0xae,
+		0xd1, 0x37, 0x4f, 0xab, 0x0e, 0xa2, 0x16, 0x7a, 0xcd, 0x18, 0xf4, 0xbc,
+		0xe9, 0x8e, 0x20, 0x56, 0xb5, 0x6e, 0xf3, 0xc4, 0xa8, 0xf5, 0x3b, 0xe7,
+		0x57, 0xe3, 0xab, 0x2b, 0x7f, 0xdb, 0x99, 0x9d, 0xef, 0x86, 0xad, 0xb9,
+		0x76, 0x77, 0xc9, 0x92, 0xa4, 0xd6, 0xda, 0xab, 0x6f, 0x5b, 0x69, 0xae,
+		0xb6, 0x0d, 0xc7, 0xe6, 0xfa, 0x59, 0xeb, 0x6b, 0xa2, 0xb5, 0x54, 0xc1,
+		0xe7, 0xcf, 0xf0, 0xf6, 0xbd, 0x17, 0x7c, 0x10, 0x3c, 0x77, 0x9d, 0x43,
+		0xc7, 0xab, 0xcd, 0xea, 0x5b, 0x61, 0xdb, 0x69, 0x15, 0x63, 0x3a, 0x2a,
+		0x4c, 0x8c, 0x5b, 0x95, 0x3a, 0xac, 0x6e, 0x07, 0x74, 0x7f, 0xb3, 0xff,
+		0x6b, 0xf9, 0x07, 0x2b, 0xcb, 0x96, 0x4f, 0x83, 0x11, 0x00, 0x00,
 	},
 		"assets/stats.html",
 	)
@@ -5679,11 +5687,13 @@ var _bindata = map[string]func() ([]byte, error){
 // directory embedded in the file by go-bindata.
 // For example if you run go-bindata on data/... and data contains the
 // following hierarchy:
-//     data/
-//       foo.txt
-//       img/
-//         a.png
-//         b.png
+//
+//	data/
+//	  foo.txt
+//	  img/
+//	    a.png
+//	    b.png
+//
 // then AssetDir("data") would return []string{"foo.txt", "img"}
 // AssetDir("data/img") would return []string{"a.png", "b.png"}
 // AssetDir("foo.txt") and AssetDir("notexist") would return an error
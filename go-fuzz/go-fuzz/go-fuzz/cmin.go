@@ -0,0 +1,144 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+type cminInput struct {
+	data  []byte
+	cover []byte
+}
+
+// minimizeCorpusMain implements -minimize-corpus mode: it executes every
+// input in workdir/corpus and removes inputs that do not contribute
+// to the total coverage of the corpus. Crashing inputs are removed as well.
+func minimizeCorpusMain() {
+	if *flagWorkdir == "" {
+		log.Fatalf("-workdir is not set")
+	}
+	if *flagBin == "" {
+		log.Fatalf("-bin is not set")
+	}
+	coverBin, sonarBin, checkedBin, metadata := unpackBinary(*flagBin)
+	defer os.Remove(coverBin)
+	os.Remove(sonarBin)
+	if checkedBin != "" {
+		os.Remove(checkedBin)
+	}
+	bin := newTestBinary(coverBin, selectFuzzFunc(metadata.Funcs), func() {}, &Stats{})
+	defer bin.close()
+
+	dir := filepath.Join(*flagWorkdir, "corpus")
+	corpus := newPersistentSet(dir)
+	var data [][]byte
+	for _, a := range corpus.m {
+		data = append(data, a.data)
+	}
+	keep, cover := minimizeInputs(bin, data)
+	removed := pruneDir(dir, keep)
+	log.Printf("corpus: %v inputs, removed %v, cover: %v",
+		len(corpus.m), removed, updateMaxCover(make([]byte, coverRegionSize), cover))
+}
+
+// pruneDir removes files in dir that are not in keep, as well as duplicates.
+// It returns the number of removed files.
+func pruneDir(dir string, keep map[Sig]bool) int {
+	keep1 := make(map[Sig]bool)
+	for sig := range keep {
+		keep1[sig] = true
+	}
+	removed := 0
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Printf("failed to read file: %v", err)
+			return nil
+		}
+		sig := hash(data)
+		if keep1[sig] {
+			delete(keep1, sig) // remove duplicates
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("failed to remove file: %v", err)
+			return nil
+		}
+		removed++
+		return nil
+	})
+	return removed
+}
+
+// minimizeInputs executes inputs and selects a subset of them that gives
+// the same total coverage. Crashing inputs are dropped. It returns hashes
+// of the selected inputs and their coverage.
+func minimizeInputs(bin *TestBinary, inputs [][]byte) (keep map[Sig]bool, cover []byte) {
+	var cinputs []cminInput
+	maxCover := make([]byte, coverRegionSize)
+	for _, data := range inputs {
+		data1 := data
+		if len(data1) > MaxInputSize {
+			data1 = data1[:MaxInputSize]
+		}
+		res, _, cover, _, _, crashed, _ := bin.test(data1)
+		if crashed || res < 0 {
+			continue
+		}
+		inp := cminInput{data, make([]byte, coverRegionSize)}
+		for i, v := range cover {
+			if i < coverSize {
+				v = roundUpCover(v)
+			}
+			inp.cover[i] = v
+		}
+		updateMaxCover(maxCover, inp.cover)
+		cinputs = append(cinputs, inp)
+	}
+
+	// Greedily keep smaller inputs: an input is kept if it covers
+	// something that is not covered by the already kept inputs.
+	sort.Sort(cminSorter(cinputs))
+	keep = make(map[Sig]bool)
+	cover = make([]byte, coverRegionSize)
+	for _, inp := range cinputs {
+		if !compareCover(cover, inp.cover) {
+			continue
+		}
+		updateMaxCover(cover, inp.cover)
+		keep[hash(inp.data)] = true
+	}
+	if worseCover(maxCover, cover) {
+		log.Fatalf("minimized corpus does not reach the coverage of the original corpus")
+	}
+	return keep, cover
+}
+
+type cminSorter []cminInput
+
+func (s cminSorter) Len() int {
+	return len(s)
+}
+
+func (s cminSorter) Less(i, j int) bool {
+	if len(s[i].data) != len(s[j].data) {
+		return len(s[i].data) < len(s[j].data)
+	}
+	return bytes.Compare(s[i].data, s[j].data) < 0
+}
+
+func (s cminSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
@@ -4,7 +4,7 @@
 package main
 
 func compareCoverBody(base, cur []byte) bool {
-	return compareCoverBody1(&base[0], &cur[0])
+	return compareCoverBody1(&base[0], &cur[0], len(cur))
 }
 
-func compareCoverBody1(base, cur *byte) bool // in compare_amd64.s
+func compareCoverBody1(base, cur *byte, n int) bool // in compare_amd64.s
@@ -1,10 +1,11 @@
 #include "textflag.h"
 
-// func compareCoverBody1(base, cur *byte) bool
-TEXT ·compareCoverBody1(SB), NOSPLIT, $0-17
+// func compareCoverBody1(base, cur *byte, n int) bool
+TEXT ·compareCoverBody1(SB), NOSPLIT, $0-25
 	MOVQ	base+0(FP), SI
 	MOVQ	cur+8(FP), DI
-	MOVQ	$65535, AX	// loop counter (CoverSize)
+	MOVQ	n+16(FP), AX
+	SUBQ	$1, AX		// loop counter
 	MOVQ	$0, R10		// ret
 	BYTE	$0x90		// nop
 	BYTE	$0x90
@@ -34,7 +35,7 @@ non_zero:
 new_cover:
 	MOVB	$1, R10
 done:
-	MOVB	R10, ret+16(FP)
+	MOVB	R10, ret+24(FP)
 	RET
 
 
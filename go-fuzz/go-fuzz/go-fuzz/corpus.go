@@ -0,0 +1,447 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	gotoken "go/token"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+// nativeHeader is the first line of files in native Go fuzzing corpus
+// (testdata/fuzz/FuzzXxx directories used by go test).
+const nativeHeader = "go test fuzz v1"
+
+// corpusMain implements conversion between workdir and native Go fuzzing corpus:
+//
+//	go-fuzz -bin=./pkg-fuzz.zip -workdir=dir corpus export testdata/fuzz/FuzzXxx
+//	go-fuzz -bin=./pkg-fuzz.zip -workdir=dir corpus import testdata/fuzz/FuzzXxx
+//
+// Export writes corpus inputs and crashers, so that crashers become
+// regression tests under go test. Import adds inputs to workdir/corpus.
+// Inputs that are already present on the other side are skipped.
+// The binary is used only to find out arguments of the fuzz function:
+// inputs of structure-aware fuzz functions are converted to files
+// with a value per argument.
+func corpusMain(args []string) {
+	if *flagWorkdir == "" {
+		log.Fatalf("-workdir is not set")
+	}
+	if *flagBin == "" {
+		log.Fatalf("-bin is not set")
+	}
+	if len(args) != 2 {
+		log.Fatalf("usage: go-fuzz -bin=./pkg-fuzz.zip -workdir=dir corpus export|import testdata/fuzz/FuzzXxx")
+	}
+	typed := nativeArgs(readMetadata(*flagBin))
+	dir := args[1]
+	switch args[0] {
+	case "export":
+		native := readNativeCorpus(typed, dir)
+		if err := os.MkdirAll(dir, 0770); err != nil {
+			log.Fatalf("failed to create dir: %v", err)
+		}
+		exported, dup := 0, 0
+		for _, sub := range []string{"corpus", "crashers"} {
+			ps := newPersistentSet(filepath.Join(*flagWorkdir, sub))
+			for _, a := range ps.m {
+				data := nativeCanonical(typed, a.data)
+				sig := hash(data)
+				if native[sig] {
+					dup++
+					continue
+				}
+				native[sig] = true
+				file := encodeNative(typed, data)
+				sum := sha256.Sum256(file)
+				name := filepath.Join(dir, fmt.Sprintf("%x", sum)[:16])
+				if err := ioutil.WriteFile(name, file, 0660); err != nil {
+					log.Fatalf("failed to write file: %v", err)
+				}
+				exported++
+			}
+		}
+		log.Printf("exported %v inputs to %v (%v already present)", exported, dir, dup)
+	case "import":
+		corpus := newPersistentSet(filepath.Join(*flagWorkdir, "corpus"))
+		crashers := newPersistentSet(filepath.Join(*flagWorkdir, "crashers"))
+		known := make(map[Sig]bool)
+		for _, ps := range []*PersistentSet{corpus, crashers} {
+			for _, a := range ps.m {
+				known[hash(nativeCanonical(typed, a.data))] = true
+			}
+		}
+		imported, dup := 0, 0
+		for _, data := range readNativeInputs(typed, dir) {
+			if known[hash(data)] || !corpus.add(Artifact{data, 0, false}) {
+				dup++
+				continue
+			}
+			imported++
+		}
+		log.Printf("imported %v inputs from %v (%v already present)", imported, dir, dup)
+	default:
+		log.Fatalf("unknown corpus subcommand %v", args[0])
+	}
+}
+
+// readMetadata reads metadata of the binary built by go-fuzz-build.
+func readMetadata(bin string) MetaData {
+	zipr, err := zip.OpenReader(bin)
+	if err != nil {
+		log.Fatalf("failed to open bin file: %v", err)
+	}
+	defer zipr.Close()
+	var metadata MetaData
+	for _, zipf := range zipr.File {
+		if zipf.Name != "metadata" {
+			continue
+		}
+		r, err := zipf.Open()
+		if err != nil {
+			log.Fatalf("failed to uzip file from input archive: %v", err)
+		}
+		defer r.Close()
+		if err := json.NewDecoder(r).Decode(&metadata); err != nil {
+			log.Fatalf("failed to decode metadata: %v", err)
+		}
+		return metadata
+	}
+	log.Fatalf("bad input archive: missing metadata")
+	return metadata
+}
+
+// nativeArgs returns arguments of the fuzz function selected with -func
+// if it is a structure-aware fuzz function (nil otherwise).
+// Native Go fuzzing supports only arguments of basic types,
+// for other arguments it fails, as inputs can't be converted.
+func nativeArgs(metadata MetaData) *TypedArgs {
+	if len(metadata.Funcs) == 0 {
+		return nil
+	}
+	fn := metadata.Funcs[selectFuzzFunc(metadata.Funcs)]
+	args := newTypedArgs(metadata, fn)
+	if args == nil {
+		return nil
+	}
+	for _, t := range args.args {
+		if name := args.types[t].Name; nativeType(name) == "" {
+			log.Fatalf("%v has argument of type %v, native Go fuzzing corpus supports only "+
+				"[]byte, string, bool, integer and float arguments", fn, name)
+		}
+	}
+	return args
+}
+
+// nativeType returns canonical name of Go type name
+// if values of the type can be stored in native corpus files.
+func nativeType(name string) string {
+	switch name {
+	case "[]byte", "[]uint8":
+		return "[]byte"
+	case "byte":
+		return "uint8"
+	case "rune":
+		return "int32"
+	case "string", "bool", "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64":
+		return name
+	}
+	return ""
+}
+
+// nativeCanonical returns data as it is represented in native corpus files:
+// inputs of structure-aware fuzz functions lose bytes that are not decoded into arguments.
+func nativeCanonical(typed *TypedArgs, data []byte) []byte {
+	if typed == nil {
+		return data
+	}
+	return typed.encode(typed.decode(data))
+}
+
+// readNativeCorpus returns hashes of inputs in native corpus dir.
+func readNativeCorpus(typed *TypedArgs, dir string) map[Sig]bool {
+	sigs := make(map[Sig]bool)
+	for _, data := range readNativeInputs(typed, dir) {
+		sigs[hash(data)] = true
+	}
+	return sigs
+}
+
+// readNativeInputs decodes all files in native corpus dir (it may not exist).
+// Files that can't be represented as go-fuzz inputs are skipped.
+func readNativeInputs(typed *TypedArgs, dir string) [][]byte {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		log.Fatalf("failed to read dir: %v", err)
+	}
+	var inputs [][]byte
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		name := filepath.Join(dir, f.Name())
+		file, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Fatalf("failed to read file: %v", err)
+		}
+		data, err := decodeNative(typed, file)
+		if err != nil {
+			log.Printf("skipping %v: %v", name, err)
+			continue
+		}
+		inputs = append(inputs, data)
+	}
+	return inputs
+}
+
+// encodeNative encodes data as a native corpus file. If typed is nil, the fuzz function
+// accepts a single []byte argument, otherwise data is decoded into typed arguments
+// (they must be of basic types, see nativeArgs).
+func encodeNative(typed *TypedArgs, data []byte) []byte {
+	if typed == nil {
+		return []byte(fmt.Sprintf("%v\n[]byte(%q)\n", nativeHeader, data))
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%v\n", nativeHeader)
+	for i, v := range typed.decode(data) {
+		desc := &typed.types[typed.args[i]]
+		switch desc.Kind {
+		case TypeBool:
+			fmt.Fprintf(buf, "bool(%v)\n", v.num != 0)
+		case TypeInt:
+			shift := uint(64 - desc.Size*8)
+			fmt.Fprintf(buf, "%v(%v)\n", desc.Name, int64(v.num<<shift)>>shift)
+		case TypeUint:
+			fmt.Fprintf(buf, "%v(%v)\n", desc.Name, v.num)
+		case TypeFloat:
+			f := math.Float64frombits(v.num)
+			if desc.Size == 4 {
+				f = float64(math.Float32frombits(uint32(v.num)))
+			}
+			switch {
+			case math.IsNaN(f) && desc.Size == 4:
+				fmt.Fprintf(buf, "math.Float32frombits(0x%x)\n", v.num)
+			case math.IsNaN(f):
+				fmt.Fprintf(buf, "math.Float64frombits(0x%x)\n", v.num)
+			default:
+				fmt.Fprintf(buf, "%v(%v)\n", desc.Name, f)
+			}
+		case TypeString:
+			fmt.Fprintf(buf, "%v(%q)\n", nativeType(desc.Name), v.data)
+		}
+	}
+	return buf.Bytes()
+}
+
+// decodeNative decodes a native corpus file. If typed is nil, only files with a single
+// []byte or string value are supported, these are what go-fuzz Fuzz(data []byte)
+// functions correspond to. Otherwise values must match the typed arguments.
+func decodeNative(typed *TypedArgs, file []byte) ([]byte, error) {
+	lines := bytes.Split(bytes.TrimSpace(file), []byte("\n"))
+	if string(bytes.TrimSpace(lines[0])) != nativeHeader {
+		return nil, fmt.Errorf("not a %q file", nativeHeader)
+	}
+	var vals []nativeValue
+	for _, ln := range lines[1:] {
+		ln = bytes.TrimSpace(ln)
+		if len(ln) == 0 {
+			continue
+		}
+		v, err := parseNativeValue(string(ln))
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	if typed == nil {
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("%v values, only single value files are supported", len(vals))
+		}
+		if vals[0].typ != "[]byte" && vals[0].typ != "string" {
+			return nil, fmt.Errorf("unsupported type %v", vals[0].typ)
+		}
+		return vals[0].data, nil
+	}
+	if len(vals) != len(typed.args) {
+		return nil, fmt.Errorf("%v values, the function has %v arguments", len(vals), len(typed.args))
+	}
+	args := make([]TypedValue, len(vals))
+	for i, v := range vals {
+		desc := &typed.types[typed.args[i]]
+		if v.typ != nativeType(desc.Name) {
+			return nil, fmt.Errorf("value %v has type %v, argument has type %v", i, v.typ, desc.Name)
+		}
+		args[i] = TypedValue{num: v.num, data: v.data}
+		if desc.Kind == TypeInt || desc.Kind == TypeUint {
+			if desc.Size < 8 {
+				args[i].num &= 1<<uint(desc.Size*8) - 1
+			}
+		}
+	}
+	return typed.encode(args), nil
+}
+
+// nativeValue is a value of a native corpus file.
+type nativeValue struct {
+	typ  string // canonical type name (see nativeType)
+	num  uint64 // bools, integers and floats (raw bits, floats are float32 bits for float32)
+	data []byte // strings and []byte
+}
+
+// parseNativeValue parses value lines like []byte("..."), string("..."), int64(-1),
+// byte('a'), float64(+Inf) and math.Float64frombits(0x7ff8000000000001).
+func parseNativeValue(s string) (nativeValue, error) {
+	var v nativeValue
+	expr, err := parser.ParseExpr(s)
+	if err != nil {
+		return v, fmt.Errorf("bad value %q: %v", s, err)
+	}
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return v, fmt.Errorf("bad value %q", s)
+	}
+	switch fun := call.Fun.(type) {
+	case *ast.ArrayType:
+		if elt, ok := fun.Elt.(*ast.Ident); !ok || fun.Len != nil || nativeType("[]"+elt.Name) != "[]byte" {
+			return v, fmt.Errorf("unsupported type in %q", s)
+		}
+		v.typ = "[]byte"
+	case *ast.Ident:
+		v.typ = nativeType(fun.Name)
+	case *ast.SelectorExpr:
+		if x, ok := fun.X.(*ast.Ident); ok && x.Name == "math" {
+			switch fun.Sel.Name {
+			case "Float32frombits":
+				v.typ = "float32"
+			case "Float64frombits":
+				v.typ = "float64"
+			}
+		}
+		if v.typ == "" {
+			return v, fmt.Errorf("unsupported type in %q", s)
+		}
+		v.num, err = parseNativeInt(call.Args[0], false)
+		if err != nil {
+			return v, fmt.Errorf("bad value %q: %v", s, err)
+		}
+		return v, nil
+	}
+	switch v.typ {
+	case "":
+		return v, fmt.Errorf("unsupported type in %q", s)
+	case "[]byte", "string":
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != gotoken.STRING {
+			return v, fmt.Errorf("bad value %q", s)
+		}
+		str, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return v, fmt.Errorf("bad value %q: %v", s, err)
+		}
+		v.data = []byte(str)
+	case "bool":
+		id, ok := call.Args[0].(*ast.Ident)
+		if !ok || id.Name != "true" && id.Name != "false" {
+			return v, fmt.Errorf("bad value %q", s)
+		}
+		if id.Name == "true" {
+			v.num = 1
+		}
+	case "float32", "float64":
+		f, err := parseNativeFloat(call.Args[0])
+		if err != nil {
+			return v, fmt.Errorf("bad value %q: %v", s, err)
+		}
+		v.num = math.Float64bits(f)
+		if v.typ == "float32" {
+			v.num = uint64(math.Float32bits(float32(f)))
+		}
+	default:
+		v.num, err = parseNativeInt(call.Args[0], v.typ[0] == 'i')
+		if err != nil {
+			return v, fmt.Errorf("bad value %q: %v", s, err)
+		}
+	}
+	return v, nil
+}
+
+// parseNativeInt parses integer and character literals (negative if signed is set).
+func parseNativeInt(x ast.Expr, signed bool) (uint64, error) {
+	neg := false
+	if u, ok := x.(*ast.UnaryExpr); ok && u.Op == gotoken.SUB && signed {
+		neg = true
+		x = u.X
+	}
+	lit, ok := x.(*ast.BasicLit)
+	if !ok {
+		return 0, fmt.Errorf("not a literal")
+	}
+	var v uint64
+	switch lit.Kind {
+	case gotoken.INT:
+		var err error
+		if v, err = strconv.ParseUint(lit.Value, 0, 64); err != nil {
+			return 0, err
+		}
+	case gotoken.CHAR:
+		c, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return 0, err
+		}
+		r := []rune(c)
+		if len(r) != 1 {
+			return 0, fmt.Errorf("bad character %v", lit.Value)
+		}
+		v = uint64(r[0])
+	default:
+		return 0, fmt.Errorf("not an integer")
+	}
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+// parseNativeFloat parses float literals, including +Inf, -Inf and NaN.
+func parseNativeFloat(x ast.Expr) (float64, error) {
+	sign := 1.0
+	if u, ok := x.(*ast.UnaryExpr); ok && (u.Op == gotoken.SUB || u.Op == gotoken.ADD) {
+		if u.Op == gotoken.SUB {
+			sign = -1
+		}
+		x = u.X
+	}
+	switch x := x.(type) {
+	case *ast.Ident:
+		switch x.Name {
+		case "Inf":
+			return math.Inf(int(sign)), nil
+		case "NaN":
+			return math.NaN(), nil
+		}
+	case *ast.BasicLit:
+		if x.Kind == gotoken.INT || x.Kind == gotoken.FLOAT {
+			f, err := strconv.ParseFloat(x.Value, 64)
+			return sign * f, err
+		}
+	}
+	return 0, fmt.Errorf("not a float")
+}
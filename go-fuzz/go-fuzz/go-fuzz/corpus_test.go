@@ -0,0 +1,117 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+func TestNativeCorpus(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("abc"), []byte("\x00\xff\n\"`\\"), bytes.Repeat([]byte{0x80}, 100)} {
+		res, err := decodeNative(nil, encodeNative(nil, data))
+		if err != nil {
+			t.Fatalf("failed to decode %q: %v", data, err)
+		}
+		if !bytes.Equal(res, data) {
+			t.Fatalf("got %q, want %q", res, data)
+		}
+	}
+	good := map[string]string{
+		"go test fuzz v1\n[]byte(\"a\\x00b\")\n": "a\x00b",
+		"go test fuzz v1\nstring(\"foo\")":       "foo",
+		"go test fuzz v1\n[]byte(`raw`)\n\n":     "raw",
+	}
+	for file, want := range good {
+		res, err := decodeNative(nil, []byte(file))
+		if err != nil {
+			t.Fatalf("failed to decode %q: %v", file, err)
+		}
+		if string(res) != want {
+			t.Fatalf("%q: got %q, want %q", file, res, want)
+		}
+	}
+	bad := []string{
+		"",
+		"go test fuzz v2\n[]byte(\"a\")\n",
+		"go test fuzz v1\n",
+		"go test fuzz v1\n[]byte(\"a\")\nint(1)\n",
+		"go test fuzz v1\nint(1)\n",
+		"go test fuzz v1\n[4]byte(\"a\")\n",
+		"go test fuzz v1\n[]byte(x)\n",
+	}
+	for _, file := range bad {
+		if _, err := decodeNative(nil, []byte(file)); err == nil {
+			t.Fatalf("decoded bad file %q", file)
+		}
+	}
+}
+
+func TestNativeCorpusTyped(t *testing.T) {
+	typed := &TypedArgs{
+		types: []TypeDesc{
+			{Kind: TypeInt, Name: "int", Size: 8},
+			{Kind: TypeString, Name: "string"},
+			{Kind: TypeString, Name: "[]byte"},
+			{Kind: TypeBool, Name: "bool"},
+			{Kind: TypeUint, Name: "byte", Size: 1},
+			{Kind: TypeInt, Name: "int16", Size: 2},
+			{Kind: TypeFloat, Name: "float64", Size: 8},
+			{Kind: TypeFloat, Name: "float32", Size: 4},
+		},
+		args: []int{0, 1, 2, 3, 4, 5, 6, 7},
+	}
+	vals := []TypedValue{
+		{num: uint64(1<<64 - 42)},
+		{data: []byte("a\x00\"")},
+		{data: []byte{0xff}},
+		{num: 1},
+		{num: 'x'},
+		{num: 0xfffe},
+		{num: math.Float64bits(math.Inf(-1))},
+		{num: uint64(math.Float32bits(1.5))},
+	}
+	data := typed.encode(vals)
+	file := encodeNative(typed, data)
+	want := `go test fuzz v1
+int(-42)
+string("a\x00\"")
+[]byte("\xff")
+bool(true)
+byte(120)
+int16(-2)
+float64(-Inf)
+float32(1.5)
+`
+	if string(file) != want {
+		t.Fatalf("bad native file:\n%s\nwant:\n%s", file, want)
+	}
+	res, err := decodeNative(typed, file)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if !bytes.Equal(res, data) {
+		t.Fatalf("got %q, want %q", res, data)
+	}
+	// Files written by go test use different but equivalent notation.
+	file = []byte("go test fuzz v1\nint(-42)\nstring(\"a\\x00\\\"\")\n[]uint8(\"\\xff\")\nbool(true)\nuint8('x')\n" +
+		"int16(-0x2)\nfloat64(-Inf)\nmath.Float32frombits(0x3fc00000)\n")
+	if res, err = decodeNative(typed, file); err != nil || !bytes.Equal(res, data) {
+		t.Fatalf("got %q (%v), want %q", res, err, data)
+	}
+	bad := []string{
+		"go test fuzz v1\n[]byte(\"a\")\n",
+		"go test fuzz v1\nint(-42)\nstring(\"\")\n[]byte(\"\")\nbool(true)\nbyte(1)\nint16(1)\nfloat64(1)\nfloat64(1)\n",
+		"go test fuzz v1\nint(-42)\nstring(\"\")\n[]byte(\"\")\nbool(1)\nbyte(1)\nint16(1)\nfloat64(1)\nfloat32(1)\n",
+		"go test fuzz v1\nint(-42)\nstring(\"\")\n[]byte(\"\")\nbool(true)\nbyte(-1)\nint16(1)\nfloat64(1)\nfloat32(1)\n",
+	}
+	for _, file := range bad {
+		if _, err := decodeNative(typed, []byte(file)); err == nil {
+			t.Fatalf("decoded bad file %q", file)
+		}
+	}
+}
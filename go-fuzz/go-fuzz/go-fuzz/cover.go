@@ -11,12 +11,29 @@ import (
 	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
 )
 
+// Size of coverage table and of the whole coverage region (coverage table
+// followed by value profile table) of the test binary. The binary can be
+// built with a non-default table size, so CoverSize and CoverRegionSize
+// constants must not be used directly.
+var (
+	coverSize       = CoverSize
+	coverRegionSize = CoverRegionSize
+)
+
+// setCoverSize sets coverage table size according to the binary metadata.
+func setCoverSize(metadata MetaData) {
+	if metadata.CoverSize != 0 {
+		coverSize = metadata.CoverSize
+	}
+	coverRegionSize = coverSize + ValueProfileSize
+}
+
 func makeCopy(data []byte) []byte {
 	return append([]byte{}, data...)
 }
 
 func compareCover(base, cur []byte) bool {
-	if len(base) != CoverSize || len(cur) != CoverSize {
+	if len(base) != coverRegionSize || len(cur) != coverRegionSize {
 		log.Fatalf("bad cover table size (%v, %v)", len(base), len(cur))
 	}
 	res := compareCoverBody(base, cur)
@@ -40,12 +57,14 @@ func compareCoverDump(base, cur []byte) bool {
 	return false
 }
 
+// updateMaxCover merges cur into base and returns number of covered
+// blocks (value profile is not counted).
 func updateMaxCover(base, cur []byte) int {
-	if len(base) != CoverSize || len(cur) != CoverSize {
+	if len(base) != coverRegionSize || len(cur) != coverRegionSize {
 		log.Fatalf("bad cover table size (%v, %v)", len(base), len(cur))
 	}
 	cnt := 0
-	for i, x := range cur {
+	for i, x := range cur[:coverSize] {
 		x = roundUpCover(x)
 		v := base[i]
 		if v != 0 || x > 0 {
@@ -55,6 +74,12 @@ func updateMaxCover(base, cur []byte) int {
 			base[i] = x
 		}
 	}
+	// Value profile values are distances rather than counters, so they are not quantized.
+	for i, x := range cur[coverSize:] {
+		if base[coverSize+i] < x {
+			base[coverSize+i] = x
+		}
+	}
 	return cnt
 }
 
@@ -79,7 +104,7 @@ func roundUpCover(x byte) byte {
 }
 
 func findNewCover(base, cover []byte) (res []byte, notEmpty bool) {
-	res = make([]byte, CoverSize)
+	res = make([]byte, coverRegionSize)
 	for i, b := range base {
 		c := cover[i]
 		if c > b {
@@ -100,11 +125,13 @@ func worseCover(base, cover []byte) bool {
 	return false
 }
 
-func dumpCover(outf string, blocks map[int][]CoverBlock, cover []byte) {
-	// Exclude files that have no coverage at all.
+// dumpCover writes coverage profile in go tool cover format. Files that have
+// no coverage at all are skipped (they are mostly irrelevant std packages),
+// unless instrumentation was restricted with -include/-exclude flags of go-fuzz-build.
+func dumpCover(outf string, blocks map[int][]CoverBlock, cover []byte, all bool) {
 	files := make(map[string]bool)
 	for i, v := range cover {
-		if v == 0 {
+		if v == 0 && !all {
 			continue
 		}
 		for _, b := range blocks[i] {
@@ -137,6 +164,11 @@ func dumpCover(outf string, blocks map[int][]CoverBlock, cover []byte) {
 	}
 }
 
+// filtered returns true if only some packages are instrumented.
+func filtered(f InstrFilter) bool {
+	return len(f.Include)+len(f.Exclude)+len(f.SonarInclude)+len(f.SonarExclude) != 0
+}
+
 func dumpSonar(outf string, sites []SonarSite) {
 	out, err := os.Create(outf)
 	if err != nil {
@@ -0,0 +1,205 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+type coverFile struct {
+	Name    string
+	Blocks  int
+	Covered int
+	Percent int
+}
+
+type coverLine struct {
+	Num   int
+	Text  string
+	Class string // "", "covered", "uncovered" or "partial"
+	Input string // smallest input that covers the line
+}
+
+// coverReport serves coverage of the corpus: list of files with
+// per-file coverage, or per-line coverage of a single file (?file=name).
+// Covered lines link to the smallest corpus input that covers them.
+func (m *Master) coverReport(w http.ResponseWriter, r *http.Request) {
+	file := r.FormValue("file")
+	var files []*coverFile
+	var blocks []CoverBlock
+	inputs := make(map[int]string)
+	m.mu.Lock()
+	coverFilter := m.coverFilter
+	coverDirs := m.coverDirs
+	perFile := make(map[string]*coverFile)
+	for _, b := range m.coverBlocks {
+		f := perFile[b.File]
+		if f == nil {
+			f = &coverFile{Name: b.File}
+			perFile[b.File] = f
+			files = append(files, f)
+		}
+		f.Blocks++
+		sig, covered := m.coverInputs[b.ID]
+		if covered {
+			f.Covered++
+		}
+		if b.File == file {
+			blocks = append(blocks, b)
+			if covered {
+				inputs[b.ID] = hex.EncodeToString(sig[:])
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if file == "" {
+		for _, f := range files {
+			f.Percent = f.Covered * 100 / f.Blocks
+		}
+		sort.Sort(coverFileSorter(files))
+		var filter *InstrFilter
+		if filtered(coverFilter) {
+			filter = &coverFilter
+		}
+		if err := coverFilesTemplate.Execute(w, struct {
+			Files  []*coverFile
+			Filter *InstrFilter
+		}{files, filter}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if len(blocks) == 0 {
+		http.Error(w, "unknown file", http.StatusNotFound)
+		return
+	}
+	var lines []*coverLine
+	// File is import path joined with file name, it is not a valid path on its own.
+	// Binaries built by old go-fuzz-build don't have SourceDirs.
+	if dir := coverDirs[filepath.Dir(file)]; dir != "" {
+		if src, err := ioutil.ReadFile(filepath.Join(dir, filepath.Base(file))); err == nil {
+			for i, text := range strings.Split(string(src), "\n") {
+				lines = append(lines, &coverLine{Num: i + 1, Text: text})
+			}
+		}
+	}
+	for _, b := range blocks {
+		if b.StartLine == 0 {
+			continue // block of a generated statement, it has no position
+		}
+		for len(lines) < b.EndLine {
+			// Source is not available, show bare line numbers.
+			lines = append(lines, &coverLine{Num: len(lines) + 1})
+		}
+		input, covered := inputs[b.ID]
+		for i := b.StartLine - 1; i < b.EndLine; i++ {
+			ln := lines[i]
+			switch {
+			case ln.Class == "":
+				ln.Class = "uncovered"
+				if covered {
+					ln.Class = "covered"
+				}
+			case ln.Class == "covered" && !covered, ln.Class == "uncovered" && covered:
+				ln.Class = "partial"
+			}
+			if covered && (ln.Input == "" || b.StartLine-1 == i) {
+				ln.Input = input
+			}
+		}
+	}
+	if err := coverLinesTemplate.Execute(w, struct {
+		File  string
+		Lines []*coverLine
+	}{file, lines}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// input serves a corpus input (?sig=hash) in quoted form.
+func (m *Master) input(w http.ResponseWriter, r *http.Request) {
+	var sig Sig
+	data, err := hex.DecodeString(r.FormValue("sig"))
+	if err != nil || len(data) != len(sig) {
+		http.Error(w, "bad input hash", http.StatusBadRequest)
+		return
+	}
+	copy(sig[:], data)
+	m.mu.Lock()
+	a, ok := m.corpus.m[sig]
+	m.mu.Unlock()
+	if !ok {
+		http.Error(w, "input is not in corpus", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(quoteData(a.data))
+	w.Write([]byte("\n"))
+	w.Write([]byte(hex.Dump(a.data)))
+}
+
+type coverFileSorter []*coverFile
+
+func (s coverFileSorter) Len() int {
+	return len(s)
+}
+
+func (s coverFileSorter) Less(i, j int) bool {
+	return s[i].Name < s[j].Name
+}
+
+func (s coverFileSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+var coverFilesTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<link rel="stylesheet" href="/bootstrap.min.css">
+<body>
+<div class="container-fluid">
+<h1 class="page-header">Coverage</h1>
+{{with .Filter}}<p>Only some packages are instrumented (go-fuzz-build -include/-exclude):
+block coverage include: {{range .Include}}<code>{{.}}</code> {{else}}all{{end}},
+exclude: {{range .Exclude}}<code>{{.}}</code> {{else}}none{{end}};
+sonar include: {{range .SonarInclude}}<code>{{.}}</code> {{else}}all{{end}},
+exclude: {{range .SonarExclude}}<code>{{.}}</code> {{else}}none{{end}}.</p>
+{{end}}<table class="table table-striped">
+<thead><tr><th>File</th><th>Blocks</th><th>Covered</th><th>%</th></tr></thead>
+<tbody>
+{{range .Files}}<tr><td><a href="/cover?file={{.Name}}">{{.Name}}</a></td><td>{{.Blocks}}</td><td>{{.Covered}}</td><td>{{.Percent}}</td></tr>
+{{end}}</tbody>
+</table>
+</div>
+</body>
+</html>
+`))
+
+var coverLinesTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<style>
+body { font-family: monospace; font-size: 12px; }
+table { border-collapse: collapse; }
+td { padding: 0 8px; white-space: pre; }
+a { color: inherit; }
+.covered { background-color: #c8f7c8; }
+.uncovered { background-color: #f7c8c8; }
+.partial { background-color: #f7f0c8; }
+</style>
+<body>
+<h3><a href="/cover">Coverage</a>: {{.File}}</h3>
+<table>
+{{range .Lines}}<tr class="{{.Class}}"><td>{{if .Input}}<a href="/input?sig={{.Input}}">{{.Num}}</a>{{else}}{{.Num}}{{end}}</td><td>{{.Text}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
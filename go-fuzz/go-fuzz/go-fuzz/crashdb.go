@@ -0,0 +1,265 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CrashDB groups crashers into buckets. Bucket of a crasher is determined by
+// its suppression (crash message and normalized stack, see extractSuppression),
+// so bucket ID is hash of the suppression. The database is persisted in workdir/crashdb.json.
+type CrashDB struct {
+	file    string
+	dir     string // absolute path of the workdir
+	dirty   bool
+	Buckets map[string]*Bucket
+}
+
+// Bucket describes a group of crashers with the same suppression.
+type Bucket struct {
+	Title     string // first line of crash message
+	Signature string // the suppression
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Hits      uint64
+	Crasher   string // name of the smallest reproducer in workdir/crashers
+	Size      int    // size of the smallest reproducer
+	// Hits merged from buckets of other workdirs (see bucketSource),
+	// they are remembered so that merging the same workdir again is a no-op.
+	Sources map[string]uint64 `json:",omitempty"`
+}
+
+// newCrashDB loads crash database from workdir. If there is no database,
+// it is rebuilt from existing crashers (if any).
+func newCrashDB(workdir string) *CrashDB {
+	db := &CrashDB{
+		file:    filepath.Join(workdir, "crashdb.json"),
+		dir:     absPath(workdir),
+		Buckets: make(map[string]*Bucket),
+	}
+	data, err := ioutil.ReadFile(db.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Fatalf("failed to read crash database: %v", err)
+		}
+		db.rebuild(filepath.Join(workdir, "crashers"))
+		return db
+	}
+	if err := json.Unmarshal(data, db); err != nil {
+		log.Fatalf("failed to parse crash database %v: %v", db.file, err)
+	}
+	return db
+}
+
+// rebuild buckets crashers in dir using their output files.
+func (db *CrashDB) rebuild(dir string) {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.output"))
+	for _, f := range files {
+		output, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(strings.TrimSuffix(f, ".output"))
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		db.add(extractSuppression(output), data, info.ModTime())
+	}
+}
+
+// add notes a crash with the given suppression and reproducer.
+// It returns true if the reproducer needs to be saved: either it is
+// the first one in the bucket or it is smaller than the current one.
+func (db *CrashDB) add(supp, data []byte, t time.Time) bool {
+	db.dirty = true
+	sig := hash(supp)
+	id := hex.EncodeToString(sig[:])
+	crasher := hash(data)
+	b := db.Buckets[id]
+	if b == nil {
+		title := string(supp)
+		if idx := strings.IndexByte(title, '\n'); idx != -1 {
+			title = title[:idx]
+		}
+		db.Buckets[id] = &Bucket{
+			Title:     title,
+			Signature: string(supp),
+			FirstSeen: t,
+			LastSeen:  t,
+			Hits:      1,
+			Crasher:   hex.EncodeToString(crasher[:]),
+			Size:      len(data),
+		}
+		return true
+	}
+	b.Hits++
+	if b.LastSeen.Before(t) {
+		b.LastSeen = t
+	}
+	if b.FirstSeen.After(t) {
+		b.FirstSeen = t
+	}
+	if len(data) < b.Size {
+		b.Crasher = hex.EncodeToString(crasher[:])
+		b.Size = len(data)
+		return true
+	}
+	return false
+}
+
+// hit notes crashes that were suppressed on slaves.
+func (db *CrashDB) hit(supp Sig, n uint64) {
+	b := db.Buckets[hex.EncodeToString(supp[:])]
+	if b == nil {
+		return
+	}
+	db.dirty = true
+	b.Hits += n
+	b.LastSeen = time.Now()
+}
+
+// merge merges bucket b from another database, returns true if
+// reproducer of b is smaller than the current one (or b is a new bucket).
+// src identifies b, see bucketSource.
+func (db *CrashDB) merge(src, id string, b *Bucket) bool {
+	db.dirty = true
+	b0 := db.Buckets[id]
+	if b0 == nil {
+		b1 := *b
+		b1.Hits = 0
+		b1.Sources = nil
+		db.Buckets[id] = &b1
+		db.mergeHits(&b1, src, b)
+		return true
+	}
+	db.mergeHits(b0, src, b)
+	if b0.FirstSeen.After(b.FirstSeen) {
+		b0.FirstSeen = b.FirstSeen
+	}
+	if b0.LastSeen.Before(b.LastSeen) {
+		b0.LastSeen = b.LastSeen
+	}
+	if b.Size < b0.Size {
+		b0.Crasher = b.Crasher
+		b0.Size = b.Size
+		return true
+	}
+	return false
+}
+
+// mergeHits adds hits of bucket b to b0. Hits that b got from other workdirs
+// are accounted to these workdirs, and for every source only the hits that were
+// not merged before are added. So merging is idempotent and hits of db's own
+// workdir that come back through another workdir are not counted twice.
+func (db *CrashDB) mergeHits(b0 *Bucket, src string, b *Bucket) {
+	own := b.Hits
+	for s, n := range b.Sources {
+		own -= n
+		db.mergeSource(b0, s, n)
+	}
+	db.mergeSource(b0, src, own)
+}
+
+func (db *CrashDB) mergeSource(b *Bucket, src string, n uint64) {
+	if strings.HasPrefix(src, db.dir+"#") {
+		return
+	}
+	if b.Sources == nil {
+		b.Sources = make(map[string]uint64)
+	}
+	if old := b.Sources[src]; n > old {
+		b.Hits += n - old
+		b.Sources[src] = n
+	}
+}
+
+// bucketSource returns the key of bucket id of workdir in Bucket.Sources.
+func bucketSource(workdir, id string) string {
+	return absPath(workdir) + "#" + id
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func (db *CrashDB) save() {
+	if !db.dirty {
+		return
+	}
+	data, err := json.MarshalIndent(db, "", "\t")
+	if err != nil {
+		log.Fatalf("failed to serialize crash database: %v", err)
+	}
+	tmp := db.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0660); err != nil {
+		log.Printf("failed to write crash database: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, db.file); err != nil {
+		log.Printf("failed to write crash database: %v", err)
+		return
+	}
+	db.dirty = false
+}
+
+// sorted returns bucket IDs sorted by first seen time.
+func (db *CrashDB) sorted() []string {
+	var ids []string
+	for id := range db.Buckets {
+		ids = append(ids, id)
+	}
+	sort.Sort(bucketSorter{db, ids})
+	return ids
+}
+
+type bucketSorter struct {
+	db  *CrashDB
+	ids []string
+}
+
+func (s bucketSorter) Len() int {
+	return len(s.ids)
+}
+
+func (s bucketSorter) Less(i, j int) bool {
+	b1, b2 := s.db.Buckets[s.ids[i]], s.db.Buckets[s.ids[j]]
+	if !b1.FirstSeen.Equal(b2.FirstSeen) {
+		return b1.FirstSeen.Before(b2.FirstSeen)
+	}
+	return s.ids[i] < s.ids[j]
+}
+
+func (s bucketSorter) Swap(i, j int) {
+	s.ids[i], s.ids[j] = s.ids[j], s.ids[i]
+}
+
+// find returns bucket ID that starts with the given prefix.
+func (db *CrashDB) find(prefix string) (string, bool) {
+	var res []string
+	for id := range db.Buckets {
+		if strings.HasPrefix(id, prefix) {
+			res = append(res, id)
+		}
+	}
+	if len(res) != 1 {
+		return "", false
+	}
+	return res[0], true
+}
@@ -0,0 +1,45 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCrashDBMergeIdempotent(t *testing.T) {
+	newDB := func(dir string) *CrashDB {
+		return &CrashDB{dir: absPath(dir), Buckets: make(map[string]*Bucket)}
+	}
+	now := time.Now()
+	a, b := newDB("a"), newDB("b")
+	a.Buckets["x"] = &Bucket{Hits: 3, FirstSeen: now, LastSeen: now, Crasher: "1", Size: 10}
+	b.Buckets["x"] = &Bucket{Hits: 5, FirstSeen: now, LastSeen: now, Crasher: "2", Size: 20}
+
+	// Repeated merge of the same workdir does not add hits.
+	for i := 0; i < 2; i++ {
+		a.merge(bucketSource("b", "x"), "x", b.Buckets["x"])
+		if got := a.Buckets["x"].Hits; got != 8 {
+			t.Fatalf("merge %v: got %v hits, want 8", i, got)
+		}
+	}
+	// New hits in the other workdir are added.
+	b.Buckets["x"].Hits = 7
+	a.merge(bucketSource("b", "x"), "x", b.Buckets["x"])
+	if got := a.Buckets["x"].Hits; got != 10 {
+		t.Fatalf("got %v hits, want 10", got)
+	}
+	// Hits of b that came from a are not merged back into a.
+	b.merge(bucketSource("a", "x"), "x", a.Buckets["x"])
+	if got := b.Buckets["x"].Hits; got != 10 {
+		t.Fatalf("got %v hits in b, want 10", got)
+	}
+	a.merge(bucketSource("b", "x"), "x", b.Buckets["x"])
+	if got := a.Buckets["x"].Hits; got != 10 {
+		t.Fatalf("got %v hits after merging back, want 10", got)
+	}
+	if a.Buckets["x"].Crasher != "1" || b.Buckets["x"].Crasher != "1" {
+		t.Fatalf("smallest reproducer is not preserved")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+// crashesMain implements crash triage subcommands:
+//
+//	go-fuzz -workdir=dir crashes list
+//	go-fuzz -workdir=dir crashes show bucket
+//	go-fuzz -workdir=dir crashes merge otherworkdir...
+func crashesMain(args []string) {
+	if *flagWorkdir == "" {
+		log.Fatalf("-workdir is not set")
+	}
+	if len(args) == 0 {
+		log.Fatalf("usage: go-fuzz -workdir=dir crashes list|show|merge")
+	}
+	db := newCrashDB(*flagWorkdir)
+	switch args[0] {
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "BUCKET\tHITS\tFIRST SEEN\tSIZE\tCRASH\n")
+		for _, id := range db.sorted() {
+			b := db.Buckets[id]
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", id[:8], b.Hits, b.FirstSeen.Format(time.RFC3339), b.Size, b.Title)
+		}
+		w.Flush()
+	case "show":
+		if len(args) != 2 {
+			log.Fatalf("usage: go-fuzz -workdir=dir crashes show bucket")
+		}
+		id, ok := db.find(args[1])
+		if !ok {
+			log.Fatalf("bucket %v is not found or is ambiguous", args[1])
+		}
+		b := db.Buckets[id]
+		crasher := filepath.Join(*flagWorkdir, "crashers", b.Crasher)
+		fmt.Printf("bucket:     %v\n", id)
+		fmt.Printf("first seen: %v\n", b.FirstSeen.Format(time.RFC3339))
+		fmt.Printf("last seen:  %v\n", b.LastSeen.Format(time.RFC3339))
+		fmt.Printf("hits:       %v\n", b.Hits)
+		fmt.Printf("reproducer: %v (%v bytes)\n", crasher, b.Size)
+		fmt.Printf("\n%v\n", b.Signature)
+		if output, err := ioutil.ReadFile(crasher + ".output"); err == nil {
+			fmt.Printf("%s\n", output)
+		}
+	case "merge":
+		if len(args) < 2 {
+			log.Fatalf("usage: go-fuzz -workdir=dir crashes merge otherworkdir...")
+		}
+		crashers := newPersistentSet(filepath.Join(*flagWorkdir, "crashers"))
+		suppressions := newPersistentSet(filepath.Join(*flagWorkdir, "suppressions"))
+		for _, dir := range args[1:] {
+			if sameDir(dir, *flagWorkdir) {
+				log.Printf("skipping %v: it is the workdir", dir)
+				continue
+			}
+			other := newCrashDB(dir)
+			for id, b := range other.Buckets {
+				suppressions.add(Artifact{[]byte(b.Signature), 0, false})
+				if !db.merge(bucketSource(dir, id), id, b) {
+					continue
+				}
+				// The other reproducer is smaller, copy it with descriptions.
+				name := filepath.Join(dir, "crashers", b.Crasher)
+				data, err := ioutil.ReadFile(name)
+				if err != nil {
+					log.Printf("failed to read crasher: %v", err)
+					continue
+				}
+				crashers.add(Artifact{data, 0, false})
+				for _, typ := range []string{"output", "quoted"} {
+					if desc, err := ioutil.ReadFile(name + "." + typ); err == nil {
+						crashers.addDescription(data, desc, typ)
+					}
+				}
+			}
+		}
+		db.save()
+	default:
+		log.Fatalf("unknown crashes subcommand %v", args[0])
+	}
+}
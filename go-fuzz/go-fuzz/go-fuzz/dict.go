@@ -0,0 +1,116 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// loadDicts reads dictionary file specified with -dict flag
+// and all files in workdir/dict dir, and returns deduplicated tokens.
+func loadDicts() [][]byte {
+	var files []string
+	if *flagDict != "" {
+		files = append(files, *flagDict)
+	}
+	dir := filepath.Join(*flagWorkdir, "dict")
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("failed to read dictionary dir: %v", err)
+	}
+	for _, info := range infos {
+		if !info.IsDir() {
+			files = append(files, filepath.Join(dir, info.Name()))
+		}
+	}
+	var dict [][]byte
+	seen := make(map[string]bool)
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			log.Fatalf("failed to read dictionary: %v", err)
+		}
+		tokens, err := parseDict(data)
+		if err != nil {
+			log.Fatalf("failed to parse dictionary %v: %v", f, err)
+		}
+		for _, tok := range tokens {
+			if !seen[string(tok)] {
+				seen[string(tok)] = true
+				dict = append(dict, tok)
+			}
+		}
+	}
+	return dict
+}
+
+// parseDict parses dictionary in AFL/libFuzzer format:
+//
+//	# comment
+//	"token"
+//	name="token with \"escapes\" \x00\xff"
+//	name@1="token with level"
+//
+// Levels are ignored.
+func parseDict(data []byte) ([][]byte, error) {
+	var tokens [][]byte
+	for i, line := range bytes.Split(data, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		start := bytes.IndexByte(line, '"')
+		if start == -1 || len(line) < start+2 || line[len(line)-1] != '"' {
+			return nil, fmt.Errorf("line %v: token is not quoted", i+1)
+		}
+		if name := bytes.TrimSpace(line[:start]); len(name) != 0 && name[len(name)-1] != '=' {
+			return nil, fmt.Errorf("line %v: expect name=\"token\"", i+1)
+		}
+		tok, err := unescapeDictToken(line[start+1 : len(line)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", i+1, err)
+		}
+		if len(tok) != 0 {
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens, nil
+}
+
+func unescapeDictToken(s []byte) ([]byte, error) {
+	var tok []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			tok = append(tok, s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return nil, fmt.Errorf("unterminated escape sequence")
+		}
+		switch s[i] {
+		case '\\', '"':
+			tok = append(tok, s[i])
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("bad hex escape sequence")
+			}
+			v, err := strconv.ParseUint(string(s[i+1:i+3]), 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("bad hex escape sequence")
+			}
+			tok = append(tok, byte(v))
+			i += 2
+		default:
+			return nil, fmt.Errorf("unknown escape sequence \\%c", s[i])
+		}
+	}
+	return tok, nil
+}
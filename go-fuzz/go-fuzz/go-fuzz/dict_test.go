@@ -0,0 +1,67 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDict(t *testing.T) {
+	tests := []struct {
+		dict   string
+		tokens []string
+		err    bool
+	}{
+		{`"foo"`, []string{"foo"}, false},
+		{"\"foo\"\n\"bar\"\n", []string{"foo", "bar"}, false},
+		// Escapes.
+		{`"\x00\xff\x41"`, []string{"\x00\xffA"}, false},
+		{`"a\\b"`, []string{`a\b`}, false},
+		{`"\"quoted\""`, []string{`"quoted"`}, false},
+		{`"\\\""`, []string{`\"`}, false},
+		// Names and levels.
+		{`kw1="foo"`, []string{"foo"}, false},
+		{`kw1 = "foo"`, []string{"foo"}, false},
+		{`kw1@1="foo"`, []string{"foo"}, false},
+		{`header_png@10="\x89PNG"`, []string{"\x89PNG"}, false},
+		// Comments, blank lines and empty tokens.
+		{"# comment\n\n  \t\n\"foo\"\n# \"bar\"\n", []string{"foo"}, false},
+		{"\"\"\n\"foo\"", []string{"foo"}, false},
+		{"\r\n\"foo\"\r\n", []string{"foo"}, false},
+		{"", nil, false},
+		// Malformed lines.
+		{`foo`, nil, true},
+		{`"foo`, nil, true},
+		{`foo"`, nil, true},
+		{`"`, nil, true},
+		{`kw1"foo"`, nil, true},
+		{`kw1="foo" # comment`, nil, true},
+		{`"foo\"`, nil, true},
+		{`"\x4"`, nil, true},
+		{`"\xzz"`, nil, true},
+		{`"\n"`, nil, true},
+		{"\"foo\"\nbar\n", nil, true},
+	}
+	for _, test := range tests {
+		tokens, err := parseDict([]byte(test.dict))
+		if test.err {
+			if err == nil {
+				t.Errorf("parsed bad dictionary %q", test.dict)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", test.dict, err)
+			continue
+		}
+		var got []string
+		for _, tok := range tokens {
+			got = append(got, string(tok))
+		}
+		if !reflect.DeepEqual(got, test.tokens) {
+			t.Errorf("%q: got tokens %q, want %q", test.dict, got, test.tokens)
+		}
+	}
+}
@@ -0,0 +1,553 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package grammar generates and mutates inputs according to a user-supplied
+// EBNF grammar. Inputs are represented by derivation trees, mutations replace
+// subtrees with other derivations of the same production, so mutated inputs
+// stay syntactically valid.
+//
+// The grammar uses the notation of the Go language specification:
+//
+//	Production  = name "=" [ Expression ] "." .
+//	Expression  = Alternative { "|" Alternative } .
+//	Alternative = Term { Term } .
+//	Term        = name | token [ "…" token ] | Group | Option | Repetition .
+//	Group       = "(" Expression ")" .
+//	Option      = "[" Expression "]" .
+//	Repetition  = "{" Expression "}" .
+//
+// Tokens are Go string literals, "a" … "z" denotes a character range.
+// The first production is the start symbol.
+package grammar
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"text/scanner"
+	"unicode/utf8"
+)
+
+const (
+	maxDepth      = 30     // derivations deeper than this use the shortest alternatives
+	maxRepeat     = 8      // max number of iterations of a generated repetition
+	maxNodes      = 10000  // generation uses the shortest alternatives after this number of nodes
+	maxParseSteps = 100000 // parsing of an input gives up after this number of steps
+)
+
+const (
+	exprSeq = iota
+	exprAlt
+	exprOpt
+	exprRep
+	exprName
+	exprToken
+	exprRange
+)
+
+type expr struct {
+	kind   int
+	list   []*expr // elements of sequences and alternatives, single element for options and repetitions
+	name   string  // production name
+	text   string  // token text
+	lo, hi rune    // character range
+}
+
+// Grammar is a parsed grammar, it is immutable and can be used concurrently.
+type Grammar struct {
+	start string
+	prods map[string]*expr // nil for empty productions
+	depth map[string]int   // minimal depth of derivation trees of productions
+}
+
+// Tree is a derivation tree of an input. Inner nodes correspond to productions,
+// leaves hold text of tokens. Trees are never modified after creation,
+// so subtrees are shared between trees.
+type Tree struct {
+	Prod string // production name, empty for leaves
+	Text string
+	Kids []*Tree
+}
+
+// Bytes returns the input represented by the tree.
+func (t *Tree) Bytes() []byte {
+	var buf bytes.Buffer
+	t.write(&buf)
+	return buf.Bytes()
+}
+
+func (t *Tree) write(buf *bytes.Buffer) {
+	buf.WriteString(t.Text)
+	for _, k := range t.Kids {
+		k.write(buf)
+	}
+}
+
+// Parse parses grammar src.
+func Parse(src []byte) (*Grammar, error) {
+	p := &grammarParser{g: &Grammar{prods: make(map[string]*expr)}}
+	p.s.Init(bytes.NewReader(src))
+	p.s.Error = func(s *scanner.Scanner, msg string) {
+		p.errorf("%v", msg)
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	if err := p.g.check(); err != nil {
+		return nil, err
+	}
+	return p.g, nil
+}
+
+type grammarParser struct {
+	g   *Grammar
+	s   scanner.Scanner
+	tok rune
+	err error
+}
+
+func (p *grammarParser) errorf(msg string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("%v: %v", p.s.Position, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (p *grammarParser) next() {
+	p.tok = p.s.Scan()
+}
+
+func (p *grammarParser) expect(tok rune) {
+	if p.tok != tok {
+		p.errorf("expected %v, found %q", scanner.TokenString(tok), p.s.TokenText())
+	}
+	p.next()
+}
+
+func (p *grammarParser) parse() error {
+	for p.next(); p.tok != scanner.EOF && p.err == nil; {
+		name := p.s.TokenText()
+		p.expect(scanner.Ident)
+		p.expect('=')
+		var e *expr
+		if p.tok != '.' {
+			e = p.parseExpr()
+		}
+		p.expect('.')
+		if p.err != nil {
+			break
+		}
+		if _, ok := p.g.prods[name]; ok {
+			p.errorf("production %v is redefined", name)
+		}
+		if p.g.start == "" {
+			p.g.start = name
+		}
+		p.g.prods[name] = e
+	}
+	if p.err == nil && p.g.start == "" {
+		p.errorf("grammar is empty")
+	}
+	return p.err
+}
+
+func (p *grammarParser) parseExpr() *expr {
+	alt := &expr{kind: exprAlt}
+	for {
+		seq := &expr{kind: exprSeq}
+		for p.err == nil {
+			e := p.parseTerm()
+			if e == nil {
+				break
+			}
+			seq.list = append(seq.list, e)
+		}
+		if len(seq.list) == 0 {
+			p.errorf("expected term, found %q", p.s.TokenText())
+		}
+		alt.list = append(alt.list, simplify(seq))
+		if p.tok != '|' || p.err != nil {
+			break
+		}
+		p.next()
+	}
+	return simplify(alt)
+}
+
+// parseTerm returns nil if the current token does not start a term.
+func (p *grammarParser) parseTerm() *expr {
+	switch p.tok {
+	case scanner.Ident:
+		e := &expr{kind: exprName, name: p.s.TokenText()}
+		p.next()
+		return e
+	case scanner.String, scanner.RawString:
+		text := p.token()
+		if p.tok != '…' {
+			return &expr{kind: exprToken, text: text}
+		}
+		p.next()
+		hi := p.token()
+		lo, n1 := utf8.DecodeRuneInString(text)
+		r, n2 := utf8.DecodeRuneInString(hi)
+		if n1 != len(text) || n2 != len(hi) || lo > r {
+			p.errorf("bad character range %q … %q", text, hi)
+		}
+		return &expr{kind: exprRange, lo: lo, hi: r}
+	case '(', '[', '{':
+		open := p.tok
+		p.next()
+		e := p.parseExpr()
+		switch open {
+		case '(':
+			p.expect(')')
+			return e
+		case '[':
+			p.expect(']')
+			return &expr{kind: exprOpt, list: []*expr{e}}
+		default:
+			p.expect('}')
+			return &expr{kind: exprRep, list: []*expr{e}}
+		}
+	}
+	return nil
+}
+
+func (p *grammarParser) token() string {
+	lit := p.s.TokenText()
+	p.next()
+	text, err := strconv.Unquote(lit)
+	if err != nil {
+		p.errorf("bad token %v: %v", lit, err)
+	}
+	if text == "" {
+		p.errorf("empty token")
+	}
+	return text
+}
+
+func simplify(e *expr) *expr {
+	if len(e.list) == 1 {
+		return e.list[0]
+	}
+	return e
+}
+
+// check verifies that all used productions are defined and that
+// every production has a finite derivation, it also computes g.depth.
+func (g *Grammar) check() error {
+	for name, e := range g.prods {
+		if undef := g.undefined(e); undef != "" {
+			return fmt.Errorf("production %v refers to undefined production %v", name, undef)
+		}
+	}
+	const inf = 1 << 30
+	g.depth = make(map[string]int)
+	for name := range g.prods {
+		g.depth[name] = inf
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, e := range g.prods {
+			if d := 1 + g.exprDepth(e); d < g.depth[name] {
+				g.depth[name] = d
+				changed = true
+			}
+		}
+	}
+	for name, d := range g.depth {
+		if d >= inf {
+			return fmt.Errorf("production %v has no finite derivation", name)
+		}
+	}
+	return nil
+}
+
+func (g *Grammar) undefined(e *expr) string {
+	if e == nil {
+		return ""
+	}
+	if e.kind == exprName {
+		if _, ok := g.prods[e.name]; !ok {
+			return e.name
+		}
+	}
+	for _, e1 := range e.list {
+		if undef := g.undefined(e1); undef != "" {
+			return undef
+		}
+	}
+	return ""
+}
+
+// exprDepth returns minimal depth of derivation trees of e (given current g.depth).
+func (g *Grammar) exprDepth(e *expr) int {
+	if e == nil {
+		return 0
+	}
+	switch e.kind {
+	case exprName:
+		return g.depth[e.name]
+	case exprSeq:
+		d := 0
+		for _, e1 := range e.list {
+			if d1 := g.exprDepth(e1); d1 > d {
+				d = d1
+			}
+		}
+		return d
+	case exprAlt:
+		d := -1
+		for _, e1 := range e.list {
+			if d1 := g.exprDepth(e1); d == -1 || d1 < d {
+				d = d1
+			}
+		}
+		return d
+	default:
+		return 0
+	}
+}
+
+// Generate generates a random input.
+func (g *Grammar) Generate(r *rand.Rand) *Tree {
+	return g.generate(r, g.start, 0)
+}
+
+// generate generates a random derivation of production prod
+// as if it is located at the given depth of the tree.
+func (g *Grammar) generate(r *rand.Rand, prod string, depth int) *Tree {
+	gen := &generator{g: g, r: r}
+	return gen.prod(prod, depth)
+}
+
+type generator struct {
+	g     *Grammar
+	r     *rand.Rand
+	nodes int
+}
+
+func (gen *generator) prod(prod string, depth int) *Tree {
+	gen.nodes++
+	t := &Tree{Prod: prod}
+	gen.expr(gen.g.prods[prod], depth+1, t)
+	return t
+}
+
+func (gen *generator) expr(e *expr, depth int, t *Tree) {
+	if e == nil {
+		return
+	}
+	g, r := gen.g, gen.r
+	deep := depth >= maxDepth || gen.nodes >= maxNodes
+	switch e.kind {
+	case exprSeq:
+		for _, e1 := range e.list {
+			gen.expr(e1, depth, t)
+		}
+	case exprAlt:
+		alt := e.list[r.Intn(len(e.list))]
+		if deep {
+			// Choose the shortest alternative, this guarantees termination.
+			for _, e1 := range e.list {
+				if g.exprDepth(e1) < g.exprDepth(alt) {
+					alt = e1
+				}
+			}
+		}
+		gen.expr(alt, depth, t)
+	case exprOpt:
+		if !deep && r.Intn(2) == 0 {
+			gen.expr(e.list[0], depth, t)
+		}
+	case exprRep:
+		for i := 0; !deep && i < maxRepeat && r.Intn(3) != 0; i++ {
+			gen.expr(e.list[0], depth, t)
+		}
+	case exprName:
+		t.Kids = append(t.Kids, gen.prod(e.name, depth))
+	case exprToken:
+		t.Kids = append(t.Kids, &Tree{Text: e.text})
+	case exprRange:
+		c := e.lo + rune(r.Intn(int(e.hi-e.lo)+1))
+		t.Kids = append(t.Kids, &Tree{Text: string(c)})
+	}
+}
+
+// Mutate returns a mutated copy of t. Parts of donor (can be nil)
+// are spliced into the result.
+func (g *Grammar) Mutate(r *rand.Rand, t, donor *Tree) *Tree {
+	nm := 1
+	for r.Intn(2) == 0 {
+		nm++
+	}
+	for i := 0; i < nm; i++ {
+		n := count(t)
+		if n == 0 {
+			return g.Generate(r)
+		}
+		idx := r.Intn(n)
+		node := find(t, &idx)
+		var repl *Tree
+		switch r.Intn(3) {
+		case 0:
+			// Replace a subtree from the donor input.
+			if donor != nil {
+				var cands []*Tree
+				collect(donor, node.Prod, &cands)
+				if len(cands) != 0 {
+					repl = cands[r.Intn(len(cands))]
+				}
+			}
+		case 1:
+			// Expand recursion: replace a nested node of the same production
+			// with the node itself (e.g. (a) becomes ((a))).
+			var cands []*Tree
+			for _, k := range node.Kids {
+				collect(k, node.Prod, &cands)
+			}
+			if len(cands) != 0 {
+				inner := cands[r.Intn(len(cands))]
+				repl = replace(node, inner, node)
+			}
+		}
+		if repl == nil {
+			// Regenerate the subtree.
+			repl = g.generate(r, node.Prod, maxDepth/2)
+		}
+		t = replace(t, node, repl)
+	}
+	return t
+}
+
+// count returns number of production nodes in t.
+func count(t *Tree) int {
+	if t.Prod == "" {
+		return 0
+	}
+	n := 1
+	for _, k := range t.Kids {
+		n += count(k)
+	}
+	return n
+}
+
+// find returns production node number *idx in pre-order.
+func find(t *Tree, idx *int) *Tree {
+	if t.Prod == "" {
+		return nil
+	}
+	if *idx == 0 {
+		return t
+	}
+	*idx--
+	for _, k := range t.Kids {
+		if n := find(k, idx); n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// collect appends all nodes of production prod in t to res.
+func collect(t *Tree, prod string, res *[]*Tree) {
+	if t.Prod == prod {
+		*res = append(*res, t)
+	}
+	for _, k := range t.Kids {
+		collect(k, prod, res)
+	}
+}
+
+// replace returns copy of t where node old is replaced with repl.
+func replace(t, old, repl *Tree) *Tree {
+	if t == old {
+		return repl
+	}
+	for i, k := range t.Kids {
+		if k1 := replace(k, old, repl); k1 != k {
+			t1 := &Tree{Prod: t.Prod, Text: t.Text, Kids: append([]*Tree{}, t.Kids...)}
+			t1.Kids[i] = k1
+			return t1
+		}
+	}
+	return t
+}
+
+// ParseInput returns derivation tree of data, or nil if data does not match
+// the grammar (or parsing is too expensive, the parser does backtracking).
+func (g *Grammar) ParseInput(data []byte) *Tree {
+	p := &inputParser{g: g, data: data}
+	var res *Tree
+	p.match(g.prods[g.start], 0, nil, func(pos int, kids []*Tree) bool {
+		if pos != len(data) {
+			return false
+		}
+		res = &Tree{Prod: g.start, Kids: kids}
+		return true
+	})
+	return res
+}
+
+type inputParser struct {
+	g     *Grammar
+	data  []byte
+	steps int
+}
+
+// match matches e at data[pos:] and calls k with the position after the match
+// and kids extended with the matched subtrees. If k fails, match backtracks
+// and tries other ways to match e.
+func (p *inputParser) match(e *expr, pos int, kids []*Tree, k func(int, []*Tree) bool) bool {
+	if p.steps++; p.steps > maxParseSteps {
+		return false
+	}
+	// Kids can be shared between different branches, so always copy on append.
+	kids = kids[:len(kids):len(kids)]
+	if e == nil {
+		return k(pos, kids)
+	}
+	switch e.kind {
+	case exprSeq:
+		return p.matchSeq(e.list, pos, kids, k)
+	case exprAlt:
+		for _, e1 := range e.list {
+			if p.match(e1, pos, kids, k) {
+				return true
+			}
+		}
+		return false
+	case exprOpt:
+		return p.match(e.list[0], pos, kids, k) || k(pos, kids)
+	case exprRep:
+		return p.match(e.list[0], pos, kids, func(pos1 int, kids1 []*Tree) bool {
+			return pos1 != pos && p.match(e, pos1, kids1, k)
+		}) || k(pos, kids)
+	case exprName:
+		return p.match(p.g.prods[e.name], pos, nil, func(pos1 int, kids1 []*Tree) bool {
+			return k(pos1, append(kids, &Tree{Prod: e.name, Kids: kids1}))
+		})
+	case exprToken:
+		if !bytes.HasPrefix(p.data[pos:], []byte(e.text)) {
+			return false
+		}
+		return k(pos+len(e.text), append(kids, &Tree{Text: e.text}))
+	case exprRange:
+		c, n := utf8.DecodeRune(p.data[pos:])
+		if n == 0 || c < e.lo || c > e.hi || c == utf8.RuneError && n == 1 {
+			return false
+		}
+		return k(pos+n, append(kids, &Tree{Text: string(p.data[pos : pos+n])}))
+	default:
+		panic("bad expr kind")
+	}
+}
+
+func (p *inputParser) matchSeq(list []*expr, pos int, kids []*Tree, k func(int, []*Tree) bool) bool {
+	if len(list) == 0 {
+		return k(pos, kids)
+	}
+	return p.match(list[0], pos, kids, func(pos1 int, kids1 []*Tree) bool {
+		return p.matchSeq(list[1:], pos1, kids1, k)
+	})
+}
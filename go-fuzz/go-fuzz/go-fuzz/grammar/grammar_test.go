@@ -0,0 +1,75 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package grammar
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+const testGrammar = `
+JSON   = Value .
+Value  = Object | Array | String | Number | "true" | "false" | "null" .
+Object = "{" [ Member { "," Member } ] "}" .
+Member = String ":" Value .
+Array  = "[" [ Value { "," Value } ] "]" .
+String = "\"" { "a" … "z" } "\"" .
+Number = [ "-" ] Digit { Digit } .
+Digit  = "0" … "9" .
+`
+
+func TestGrammar(t *testing.T) {
+	g, err := Parse([]byte(testGrammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(0))
+	var trees []*Tree
+	for i := 0; i < 100; i++ {
+		tree := g.Generate(r)
+		trees = append(trees, tree)
+		data := tree.Bytes()
+		tree1 := g.ParseInput(data)
+		if tree1 == nil {
+			t.Fatalf("failed to parse generated input %q", data)
+		}
+		if !bytes.Equal(tree1.Bytes(), data) {
+			t.Fatalf("parsed input %q differs from generated %q", tree1.Bytes(), data)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		tree := trees[r.Intn(len(trees))]
+		orig := tree.Bytes()
+		mut := g.Mutate(r, tree, trees[r.Intn(len(trees))])
+		if data := mut.Bytes(); g.ParseInput(data) == nil {
+			t.Fatalf("failed to parse mutated input %q", data)
+		}
+		if !bytes.Equal(tree.Bytes(), orig) {
+			t.Fatalf("mutation modified the original tree")
+		}
+	}
+	for _, data := range []string{"", "{", `{"a":}`, "[1,]", "--1", "nul"} {
+		if g.ParseInput([]byte(data)) != nil {
+			t.Fatalf("parsed bad input %q", data)
+		}
+	}
+}
+
+func TestGrammarErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`A = "a"`,
+		`A = B .`,
+		`A = "a" . A = "b" .`,
+		`A = "a" A .`,
+		`A = "ab" … "z" .`,
+		`A = "" .`,
+		`A = ( "a" .`,
+	} {
+		if _, err := Parse([]byte(src)); err == nil {
+			t.Fatalf("parsed bad grammar %q", src)
+		}
+	}
+}
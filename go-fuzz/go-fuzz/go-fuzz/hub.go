@@ -7,12 +7,14 @@ import (
 	"fmt"
 	"log"
 	"net/rpc"
+	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+	"github.com/dvyukov/go-fuzz/go-fuzz/grammar"
 	"github.com/dvyukov/go-fuzz/go-fuzz/versifier"
 )
 
@@ -20,6 +22,14 @@ const (
 	syncPeriod   = 3 * time.Second
 	syncDeadline = 100 * syncPeriod
 
+	maxReconnectDelay = time.Minute
+	rpcTimeout        = time.Minute // hung master must not block the hub
+
+	// Limits on the number of results buffered while master is unavailable.
+	maxPendingInputs   = 10000
+	maxPendingCrashers = 1000
+	maxPendingSlow     = 1000
+
 	minScore = 1.0
 	maxScore = 1000.0
 	defScore = 10.0
@@ -30,7 +40,17 @@ const (
 // Hub also handles communication with the master.
 type Hub struct {
 	id     int
-	master *rpc.Client
+	key    uint64      // identifies this hub on master across reconnects
+	master *rpc.Client // nil while disconnected from master
+
+	// Inputs and crashers that are not yet sent to master.
+	// They are buffered while master is unavailable.
+	pendingInputs   []NewInputArgs
+	pendingCrashers []NewCrasherArgs
+	pendingSlow     []NewSlowArgs
+	pendingDropped  int // results dropped because of the limits above
+	reconnectTime   time.Time
+	reconnectDelay  time.Duration
 
 	ro atomic.Value // *ROData
 
@@ -38,19 +58,35 @@ type Hub struct {
 	maxCover   atomic.Value // []byte
 
 	initialTriage uint32
+	avgExecTime   uint64 // average exec time of corpus inputs, in ns
 
 	corpusCoverSize int
 	corpusSigs      map[Sig]struct{}
 	corpusStale     bool
 	triageQueue     []MasterInput
+	dict            [][]byte
+	grammar         *grammar.Grammar // nil if master does not have -grammar
+	blocks          []CoverBlock
+	filter          InstrFilter       // instrumented packages and files
+	srcDirs         map[string]string // see MetaData.SourceDirs
+	metadataHash    Sig
+
+	// Smallest corpus input for every covered CoverTab entry,
+	// changes are sent to master to render coverage report.
+	coverInputs map[int]coverInput
+	coverDelta  map[int]Sig
 
 	triageC     chan MasterInput
 	newInputC   chan Input
 	newCrasherC chan NewCrasherArgs
+	newSlowC    chan NewSlowArgs
 	syncC       chan Stats
 
 	stats         Stats
 	corpusOrigins [execCount]uint64
+
+	sched    Scheduler
+	edgeHits []uint64 // sampled number of executions that hit every CoverTab entry
 }
 
 type ROData struct {
@@ -58,26 +94,54 @@ type ROData struct {
 	corpusCover  []byte
 	badInputs    map[Sig]struct{}
 	suppressions map[Sig]struct{}
-	strLits      [][]byte // string literals in testee
-	intLits      [][]byte // int literals in testee
+	slow         map[Sig]struct{} // slowSig's of reported slow inputs
+	strLits      [][]byte         // string literals in testee
+	intLits      [][]byte         // int literals in testee
+	dict         [][]byte         // tokens from dictionaries
 	coverBlocks  map[int][]CoverBlock
 	sonarSites   []SonarSite
 	verse        *versifier.Verse
+	grammar      *grammar.Grammar
+	trees        []*grammar.Tree // derivation trees of corpus inputs that match the grammar
+	args         *TypedArgs      // nil if the fuzz function is not structure-aware
+}
+
+type coverInput struct {
+	sig  Sig
+	size int
 }
 
 type Stats struct {
-	execs    uint64
-	restarts uint64
+	execs     uint64
+	restarts  uint64
+	crashHits map[Sig]uint64 // crashes suppressed on slaves
+	edgeHits  []uint32       // sampled hits of CoverTab entries (dynamic schedules only)
 }
 
-func newHub(metadata MetaData) *Hub {
+func newHub(metadata MetaData, funcIdx int) *Hub {
 	procs := *flagProcs
 	hub := &Hub{
-		corpusSigs:  make(map[Sig]struct{}),
-		triageC:     make(chan MasterInput, procs),
-		newInputC:   make(chan Input, procs),
-		newCrasherC: make(chan NewCrasherArgs, procs),
-		syncC:       make(chan Stats, procs),
+		corpusSigs:   make(map[Sig]struct{}),
+		triageC:      make(chan MasterInput, procs),
+		newInputC:    make(chan Input, procs),
+		newCrasherC:  make(chan NewCrasherArgs, procs),
+		newSlowC:     make(chan NewSlowArgs, procs),
+		syncC:        make(chan Stats, procs),
+		blocks:       metadata.Blocks,
+		filter:       metadata.Filter,
+		srcDirs:      metadata.SourceDirs,
+		metadataHash: metadataHash(metadata),
+		coverInputs:  make(map[int]coverInput),
+		key:          uint64(time.Now().UnixNano()) ^ uint64(os.Getpid())<<32,
+		sched:        newScheduler(*flagSchedule),
+	}
+	if hub.sched.Dynamic() {
+		hub.edgeHits = make([]uint64, coverSize)
+	}
+	if metadata.Edges {
+		// Coverage table is indexed by edges, so it can't be mapped back
+		// to blocks: coverage report and -dumpcover are not available.
+		hub.blocks = nil
 	}
 
 	if err := hub.connect(); err != nil {
@@ -85,7 +149,7 @@ func newHub(metadata MetaData) *Hub {
 	}
 
 	coverBlocks := make(map[int][]CoverBlock)
-	for _, b := range metadata.Blocks {
+	for _, b := range hub.blocks {
 		coverBlocks[b.ID] = append(coverBlocks[b.ID], b)
 	}
 	sonarSites := make([]SonarSite, len(metadata.Sonar))
@@ -96,14 +160,19 @@ func newHub(metadata MetaData) *Hub {
 		sonarSites[i].id = b.ID
 		sonarSites[i].loc = fmt.Sprintf("%v:%v.%v,%v.%v", b.File, b.StartLine, b.StartCol, b.EndLine, b.EndCol)
 	}
-	hub.maxCover.Store(make([]byte, CoverSize))
+	hub.maxCover.Store(make([]byte, coverRegionSize))
 
 	ro := &ROData{
-		corpusCover:  make([]byte, CoverSize),
+		corpusCover:  make([]byte, coverRegionSize),
 		badInputs:    make(map[Sig]struct{}),
 		suppressions: make(map[Sig]struct{}),
 		coverBlocks:  coverBlocks,
 		sonarSites:   sonarSites,
+		dict:         hub.dict,
+		grammar:      hub.grammar,
+	}
+	if len(metadata.Funcs) != 0 {
+		ro.args = newTypedArgs(metadata, metadata.Funcs[funcIdx])
 	}
 	// Prepare list of string and integer literals.
 	for _, lit := range metadata.Literals {
@@ -121,22 +190,137 @@ func newHub(metadata MetaData) *Hub {
 }
 
 func (hub *Hub) connect() error {
-	c, err := rpc.Dial("tcp", *flagSlave)
+	c, err := dialMaster(*flagSlave)
 	if err != nil {
 		return err
 	}
+	args := &ConnectArgs{
+		Schedule:     *flagSchedule,
+		ID:           hub.id,
+		Key:          hub.key,
+		Procs:        *flagProcs,
+		Blocks:       hub.blocks,
+		Filter:       hub.filter,
+		SourceDirs:   hub.srcDirs,
+		MetadataHash: hub.metadataHash,
+	}
 	var res ConnectRes
-	if err := c.Call("Master.Connect", &ConnectArgs{Procs: *flagProcs}, &res); err != nil {
+	if err := callMaster(c, "Master.Connect", args, &res); err != nil {
+		c.Close()
 		return err
 	}
 
 	hub.master = c
+	if hub.id == 0 {
+		hub.initialTriage = uint32(len(res.Corpus))
+		hub.dict = res.Dict
+		if len(res.Grammar) != 0 {
+			g, err := grammar.Parse(res.Grammar)
+			if err != nil {
+				return fmt.Errorf("failed to parse grammar: %v", err)
+			}
+			hub.grammar = g
+		}
+	}
 	hub.id = res.ID
-	hub.initialTriage = uint32(len(res.Corpus))
-	hub.triageQueue = res.Corpus
+	// On reconnect master sends whole corpus, we need only inputs that we don't have yet.
+	for _, inp := range res.Corpus {
+		if _, ok := hub.corpusSigs[hash(inp.Data)]; !ok {
+			hub.triageQueue = append(hub.triageQueue, inp)
+		}
+	}
+	// Master may be restarted, so resend whole coverage.
+	hub.coverDelta = make(map[int]Sig)
+	for idx, inp := range hub.coverInputs {
+		hub.coverDelta[idx] = inp.sig
+	}
 	return nil
 }
 
+// reconnect tries to restore connection to master with exponential backoff.
+// It returns true if hub is connected.
+func (hub *Hub) reconnect() bool {
+	if hub.master != nil {
+		return true
+	}
+	if time.Now().Before(hub.reconnectTime) {
+		return false
+	}
+	if err := hub.connect(); err != nil {
+		if _, ok := err.(rpc.ServerError); ok {
+			// Master explicitly rejected us, retrying won't help.
+			log.Fatalf("master rejected slave: %v", err)
+		}
+		hub.reconnectDelay *= 2
+		if hub.reconnectDelay < syncPeriod {
+			hub.reconnectDelay = syncPeriod
+		}
+		if hub.reconnectDelay > maxReconnectDelay {
+			hub.reconnectDelay = maxReconnectDelay
+		}
+		hub.reconnectTime = time.Now().Add(hub.reconnectDelay)
+		log.Printf("failed to connect to master: %v, retrying in %v", err, hub.reconnectDelay)
+		return false
+	}
+	log.Printf("reconnected to master")
+	if hub.pendingDropped != 0 {
+		log.Printf("dropped %v inputs and crashers while master was unavailable", hub.pendingDropped)
+		hub.pendingDropped = 0
+	}
+	hub.reconnectDelay = 0
+	return true
+}
+
+func (hub *Hub) disconnect(err error) {
+	log.Printf("lost connection to master: %v", err)
+	hub.master.Close()
+	hub.master = nil
+}
+
+// flush sends buffered inputs and crashers to master.
+func (hub *Hub) flush() {
+	for len(hub.pendingInputs) != 0 && hub.master != nil {
+		args := hub.pendingInputs[0]
+		args.ID = hub.id
+		if err := callMaster(hub.master, "Master.NewInput", args, nil); err != nil {
+			hub.disconnect(err)
+			return
+		}
+		hub.pendingInputs[0] = NewInputArgs{}
+		hub.pendingInputs = hub.pendingInputs[1:]
+	}
+	for len(hub.pendingCrashers) != 0 && hub.master != nil {
+		if err := callMaster(hub.master, "Master.NewCrasher", hub.pendingCrashers[0], nil); err != nil {
+			hub.disconnect(err)
+			return
+		}
+		hub.pendingCrashers[0] = NewCrasherArgs{}
+		hub.pendingCrashers = hub.pendingCrashers[1:]
+	}
+	for len(hub.pendingSlow) != 0 && hub.master != nil {
+		if err := callMaster(hub.master, "Master.NewSlow", hub.pendingSlow[0], nil); err != nil {
+			hub.disconnect(err)
+			return
+		}
+		hub.pendingSlow[0] = NewSlowArgs{}
+		hub.pendingSlow = hub.pendingSlow[1:]
+	}
+}
+
+// callMaster is rpc.Client.Call with rpcTimeout.
+// On timeout the call is abandoned, the caller is expected to close the client.
+func callMaster(c *rpc.Client, method string, args, reply interface{}) error {
+	call := c.Go(method, args, reply, make(chan *rpc.Call, 1))
+	timer := time.NewTimer(rpcTimeout)
+	defer timer.Stop()
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-timer.C:
+		return fmt.Errorf("%v timed out", method)
+	}
+}
+
 func (hub *Hub) loop() {
 	// Local buffer helps to avoid deadlocks on chan overflows.
 	var triageC chan MasterInput
@@ -157,36 +341,49 @@ func (hub *Hub) loop() {
 			// Sync with the master.
 			if *flagV >= 1 {
 				ro := hub.ro.Load().(*ROData)
-				log.Printf("hub: corpus=%v bootstrap=%v fuzz=%v minimize=%v versifier=%v smash=%v sonar=%v",
+				log.Printf("hub: corpus=%v bootstrap=%v fuzz=%v minimize=%v versifier=%v smash=%v sonar=%v custom=%v grammar=%v",
 					len(ro.corpus), hub.corpusOrigins[execBootstrap]+hub.corpusOrigins[execCorpus],
 					hub.corpusOrigins[execFuzz]+hub.corpusOrigins[execSonar],
 					hub.corpusOrigins[execMinimizeInput]+hub.corpusOrigins[execMinimizeCrasher],
 					hub.corpusOrigins[execVersifier], hub.corpusOrigins[execSmash],
-					hub.corpusOrigins[execSonarHint])
+					hub.corpusOrigins[execSonarHint], hub.corpusOrigins[execCustom], hub.corpusOrigins[execGrammar])
+			}
+			if hub.corpusStale {
+				hub.updateScores()
+				hub.corpusStale = false
+			} else if hub.sched.Dynamic() && len(hub.ro.Load().(*ROData).corpus) != 0 {
+				// Dynamic schedules depend on fuzzing statistics,
+				// so their scores are recalculated on every sync.
+				hub.rescheduleScores()
+			}
+			if !hub.reconnect() {
+				// Stats are accumulated until master is back.
+				break
+			}
+			hub.flush()
+			if hub.master == nil {
+				break
 			}
 			args := &SyncArgs{
 				ID:            hub.id,
 				Execs:         hub.stats.execs,
 				Restarts:      hub.stats.restarts,
 				CoverFullness: hub.corpusCoverSize,
+				CrashHits:     hub.stats.crashHits,
+				CoverInputs:   hub.coverDelta,
 			}
-			hub.stats.execs = 0
-			hub.stats.restarts = 0
 			var res SyncRes
-			if err := hub.master.Call("Master.Sync", args, &res); err != nil {
-				log.Printf("sync call failed: %v, reconnection to master", err)
-				if err := hub.connect(); err != nil {
-					log.Printf("failed to connect to master: %v, killing slave", err)
-					return
-				}
+			if err := callMaster(hub.master, "Master.Sync", args, &res); err != nil {
+				hub.disconnect(err)
+				break
 			}
+			hub.stats.execs = 0
+			hub.stats.restarts = 0
+			hub.stats.crashHits = nil
+			hub.coverDelta = nil
 			if len(res.Inputs) > 0 {
 				hub.triageQueue = append(hub.triageQueue, res.Inputs...)
 			}
-			if hub.corpusStale {
-				hub.updateScores()
-				hub.corpusStale = false
-			}
 
 		case triageC <- triageInput:
 			// Send new input to slaves for triage.
@@ -204,6 +401,15 @@ func (hub *Hub) loop() {
 			// Sync from a slave.
 			hub.stats.execs += s.execs
 			hub.stats.restarts += s.restarts
+			for sig, n := range s.crashHits {
+				if hub.stats.crashHits == nil {
+					hub.stats.crashHits = make(map[Sig]uint64)
+				}
+				hub.stats.crashHits[sig] += n
+			}
+			for i, n := range s.edgeHits {
+				hub.edgeHits[i] += uint64(n)
+			}
 
 		case input := <-hub.newInputC:
 			// New interesting input from slaves.
@@ -230,29 +436,35 @@ func (hub *Hub) loop() {
 				scoreSum = ro1.corpus[len(ro1.corpus)-1].runningScoreSum
 			}
 			input.score = defScore
+			input.picked = new(uint64)
 			input.runningScoreSum = scoreSum + defScore
 			ro1.corpus = append(ro1.corpus, input)
 			hub.updateMaxCover(input.cover)
 			ro1.corpusCover = makeCopy(ro.corpusCover)
 			hub.corpusCoverSize = updateMaxCover(ro1.corpusCover, input.cover)
+			hub.updateCoverInputs(sig, input)
 			if input.res > 0 || input.typ == execBootstrap {
 				ro1.verse = versifier.BuildVerse(ro.verse, input.data)
 			}
+			if ro.grammar != nil {
+				if t := ro.grammar.ParseInput(input.data); t != nil {
+					ro1.trees = append(ro1.trees, t)
+				}
+			}
 			hub.ro.Store(ro1)
 			hub.corpusOrigins[input.typ]++
 
 			if input.mine {
-				if err := hub.master.Call("Master.NewInput", NewInputArgs{hub.id, input.data, uint64(input.depth)}, nil); err != nil {
-					log.Printf("new input call failed: %v, reconnecting to master", err)
-					if err := hub.connect(); err != nil {
-						log.Printf("failed to connect to master: %v, killing slave", err)
-						return
-					}
+				if len(hub.pendingInputs) < maxPendingInputs {
+					hub.pendingInputs = append(hub.pendingInputs, NewInputArgs{hub.id, input.data, uint64(input.depth)})
+				} else {
+					hub.pendingDropped++
 				}
+				hub.flush()
 			}
 
 			if *flagDumpCover {
-				dumpCover(filepath.Join(*flagWorkdir, "coverprofile"), ro.coverBlocks, ro.corpusCover)
+				dumpCover(filepath.Join(*flagWorkdir, "coverprofile"), ro1.coverBlocks, ro1.corpusCover, filtered(hub.filter))
 			}
 
 		case crash := <-hub.newCrasherC:
@@ -277,10 +489,53 @@ func (hub *Hub) loop() {
 				}
 				hub.ro.Store(ro1)
 			}
-			if err := hub.master.Call("Master.NewCrasher", crash, nil); err != nil {
-				log.Printf("new crasher call failed: %v", err)
+			if len(hub.pendingCrashers) < maxPendingCrashers {
+				hub.pendingCrashers = append(hub.pendingCrashers, crash)
+			} else {
+				hub.pendingDropped++
+			}
+			hub.flush()
+
+		case slow := <-hub.newSlowC:
+			ro := hub.ro.Load().(*ROData)
+			ro1 := new(ROData)
+			*ro1 = *ro
+			ro1.slow = make(map[Sig]struct{})
+			for k, v := range ro.slow {
+				ro1.slow[k] = v
+			}
+			for _, sig := range slow.Sigs {
+				ro1.slow[sig] = struct{}{}
 			}
+			hub.ro.Store(ro1)
+			if len(hub.pendingSlow) < maxPendingSlow {
+				hub.pendingSlow = append(hub.pendingSlow, slow)
+			} else {
+				hub.pendingDropped++
+			}
+			hub.flush()
+		}
+	}
+}
+
+// updateCoverInputs remembers input as the smallest input
+// for every CoverTab entry it covers (if it is smaller than the current one).
+func (hub *Hub) updateCoverInputs(sig Sig, input Input) {
+	if hub.blocks == nil {
+		return
+	}
+	for idx, v := range input.cover[:coverSize] {
+		if v == 0 {
+			continue
 		}
+		if cur, ok := hub.coverInputs[idx]; ok && cur.size <= len(input.data) {
+			continue
+		}
+		hub.coverInputs[idx] = coverInput{sig, len(input.data)}
+		if hub.coverDelta == nil {
+			hub.coverDelta = make(map[int]Sig)
+		}
+		hub.coverDelta[idx] = sig
 	}
 }
 
@@ -303,111 +558,39 @@ func (hub *Hub) updateMaxCover(cover []byte) bool {
 	return true
 }
 
+// updateScores recalculates scores of all corpus inputs after corpus changes.
 func (hub *Hub) updateScores() {
-	ro := hub.ro.Load().(*ROData)
-	ro1 := new(ROData)
-	*ro1 = *ro
-	corpus := make([]Input, len(ro.corpus))
-	copy(corpus, ro.corpus)
-	ro1.corpus = corpus
-
-	var sumExecTime, sumCoverSize uint64
-	for _, inp := range corpus {
-		sumExecTime += inp.execTime
-		sumCoverSize += uint64(inp.coverSize)
-	}
-	n := uint64(len(corpus))
-	avgExecTime := sumExecTime / n
-	avgCoverSize := sumCoverSize / n
-
-	// Phase 1: calculate score for each input independently.
-	for i, inp := range corpus {
-		score := defScore
-
-		// Execution time multiplier 0.1-3x.
-		// Fuzzing faster inputs increases efficiency.
-		execTime := float64(inp.execTime) / float64(avgExecTime)
-		if execTime > 10 {
-			score /= 10
-		} else if execTime > 4 {
-			score /= 4
-		} else if execTime > 2 {
-			score /= 2
-		} else if execTime < 0.25 {
-			score *= 3
-		} else if execTime < 0.33 {
-			score *= 2
-		} else if execTime < 0.5 {
-			score *= 1.5
-		}
-
-		// Coverage size multiplier 0.25-3x.
-		// Inputs with larger coverage are more interesting.
-		coverSize := float64(inp.coverSize) / float64(avgCoverSize)
-		if coverSize > 3 {
-			score *= 3
-		} else if coverSize > 2 {
-			score *= 2
-		} else if coverSize > 1.5 {
-			score *= 1.5
-		} else if coverSize < 0.3 {
-			score /= 4
-		} else if coverSize < 0.5 {
-			score /= 2
-		} else if coverSize < 0.75 {
-			score /= 1.5
-		}
-
-		// Input depth multiplier 1-5x.
-		// Deeper inputs have higher chances of digging deeper into code.
-		if inp.depth < 10 {
-			// no boost for you
-		} else if inp.depth < 20 {
-			score *= 2
-		} else if inp.depth < 40 {
-			score *= 3
-		} else if inp.depth < 80 {
-			score *= 4
-		} else {
-			score *= 5
-		}
-
-		// User boost (Fuzz function return value) multiplier 1-2x.
-		// We don't know what it is, but user said so.
-		if inp.res > 0 {
-			// Assuming this is a correct input (e.g. deserialized successfully).
-			score *= 2
-		}
+	ro, ro1 := hub.copyCorpus()
+	corpus := ro1.corpus
+	ctx := hub.scheduleContext(corpus)
 
-		if score < minScore {
-			score = minScore
-		} else if score > maxScore {
-			score = maxScore
-		}
-		corpus[i].score = int(score)
+	// Phase 1: calculate base score for each input independently.
+	for i := range corpus {
+		corpus[i].base = int(clampScore(baseScore(&corpus[i], ctx)))
 	}
 
 	// Phase 2: Choose a minimal set of (favored) inputs that give full coverage.
-	// Non-favored inputs receive minimal score.
 	type Candidate struct {
 		index  int
 		score  int
 		chosen bool
 	}
-	candidates := make([]Candidate, CoverSize)
+	candidates := make([]Candidate, coverRegionSize)
 	for idx, inp := range corpus {
 		corpus[idx].favored = false
 		for i, c := range inp.cover {
-			c = roundUpCover(c)
+			if i < coverSize {
+				c = roundUpCover(c)
+			}
 			if c == 0 || c != ro.corpusCover[i] {
 				continue
 			}
 			if c > ro.corpusCover[i] {
 				log.Fatalf("bad")
 			}
-			if candidates[i].score < inp.score {
+			if candidates[i].score < inp.base {
 				candidates[i].index = idx
-				candidates[i].score = inp.score
+				candidates[i].score = inp.base
 			}
 		}
 	}
@@ -417,22 +600,157 @@ func (hub *Hub) updateScores() {
 		}
 		inp := &corpus[cand.index]
 		inp.favored = true
-		for i := ci + 1; i < CoverSize; i++ {
-			c := roundUpCover(inp.cover[i])
+		for i := ci + 1; i < coverRegionSize; i++ {
+			c := inp.cover[i]
+			if i < coverSize {
+				c = roundUpCover(c)
+			}
 			if c == 0 || c != ro.corpusCover[i] {
 				continue
 			}
 			candidates[i].score = 0
 		}
 	}
-	scoreSum := 0
-	for i, inp := range corpus {
-		if !inp.favored {
-			inp.score = minScore
+	hub.scheduleScores(ro1, ctx)
+}
+
+// rescheduleScores recalculates only final scores of inputs for dynamic schedules.
+// Base scores and the favored set depend only on the corpus and are not changed.
+func (hub *Hub) rescheduleScores() {
+	_, ro1 := hub.copyCorpus()
+	hub.scheduleScores(ro1, hub.scheduleContext(ro1.corpus))
+}
+
+// copyCorpus returns the current ROData and its copy with a copy of corpus.
+func (hub *Hub) copyCorpus() (*ROData, *ROData) {
+	ro := hub.ro.Load().(*ROData)
+	ro1 := new(ROData)
+	*ro1 = *ro
+	ro1.corpus = make([]Input, len(ro.corpus))
+	copy(ro1.corpus, ro.corpus)
+	return ro, ro1
+}
+
+func (hub *Hub) scheduleContext(corpus []Input) *scheduleContext {
+	var sumExecTime, sumCoverSize uint64
+	for _, inp := range corpus {
+		sumExecTime += inp.execTime
+		sumCoverSize += uint64(inp.coverSize)
+	}
+	n := uint64(len(corpus))
+	ctx := &scheduleContext{
+		avgExecTime:  sumExecTime / n,
+		avgCoverSize: sumCoverSize / n,
+	}
+	atomic.StoreUint64(&hub.avgExecTime, ctx.avgExecTime)
+	return ctx
+}
+
+// scheduleScores calculates final scores of inputs (phase 3 of updateScores)
+// and publishes ro1.
+func (hub *Hub) scheduleScores(ro1 *ROData, ctx *scheduleContext) {
+	corpus := ro1.corpus
+	if hub.sched.Dynamic() {
+		var sumFreq uint64
+		for i := range corpus {
+			corpus[i].freq = inputFreq(&corpus[i], hub.edgeHits)
+			sumFreq += corpus[i].freq
 		}
-		scoreSum += inp.score
+		ctx.avgFreq = float64(sumFreq) / float64(len(corpus))
+	}
+	// Phase 3: final scores are determined by the schedule.
+	scoreSum := 0
+	for i := range corpus {
+		corpus[i].score = int(clampScore(hub.sched.Score(&corpus[i], ctx)))
+		scoreSum += corpus[i].score
 		corpus[i].runningScoreSum = scoreSum
 	}
 
 	hub.ro.Store(ro1)
 }
+
+// baseScore calculates score of the input based on its execution time,
+// coverage, depth and result of the Fuzz function.
+func baseScore(inp *Input, ctx *scheduleContext) float64 {
+	score := defScore
+
+	// Execution time multiplier 0.1-3x.
+	// Fuzzing faster inputs increases efficiency.
+	execTime := float64(inp.execTime) / float64(ctx.avgExecTime)
+	if execTime > 10 {
+		score /= 10
+	} else if execTime > 4 {
+		score /= 4
+	} else if execTime > 2 {
+		score /= 2
+	} else if execTime < 0.25 {
+		score *= 3
+	} else if execTime < 0.33 {
+		score *= 2
+	} else if execTime < 0.5 {
+		score *= 1.5
+	}
+
+	// Coverage size multiplier 0.25-3x.
+	// Inputs with larger coverage are more interesting.
+	coverSize := float64(inp.coverSize) / float64(ctx.avgCoverSize)
+	if coverSize > 3 {
+		score *= 3
+	} else if coverSize > 2 {
+		score *= 2
+	} else if coverSize > 1.5 {
+		score *= 1.5
+	} else if coverSize < 0.3 {
+		score /= 4
+	} else if coverSize < 0.5 {
+		score /= 2
+	} else if coverSize < 0.75 {
+		score /= 1.5
+	}
+
+	// Input depth multiplier 1-5x.
+	// Deeper inputs have higher chances of digging deeper into code.
+	if inp.depth < 10 {
+		// no boost for you
+	} else if inp.depth < 20 {
+		score *= 2
+	} else if inp.depth < 40 {
+		score *= 3
+	} else if inp.depth < 80 {
+		score *= 4
+	} else {
+		score *= 5
+	}
+
+	// User boost (Fuzz function return value) multiplier 1-2x.
+	// We don't know what it is, but user said so.
+	if inp.res > 0 {
+		// Assuming this is a correct input (e.g. deserialized successfully).
+		score *= 2
+	}
+	return score
+}
+
+func clampScore(score float64) float64 {
+	if score < minScore {
+		return minScore
+	} else if score > maxScore {
+		return maxScore
+	}
+	return score
+}
+
+// inputFreq returns number of (sampled) hits of the rarest coverage entry of the input.
+// This approximates how often fuzzing exercises the input path.
+func inputFreq(inp *Input, edgeHits []uint64) uint64 {
+	freq := ^uint64(0)
+	for i, v := range inp.cover[:coverSize] {
+		if v != 0 && edgeHits[i] < freq {
+			freq = edgeHits[i]
+		}
+	}
+	if freq == 0 || freq == ^uint64(0) {
+		freq = 1
+	}
+	return freq
+}
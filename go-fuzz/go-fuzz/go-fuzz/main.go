@@ -9,6 +9,7 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"runtime/debug"
 	"sync/atomic"
@@ -23,21 +24,44 @@ var (
 	flagWorkdir       = flag.String("workdir", "", "dir with persistent work data")
 	flagProcs         = flag.Int("procs", runtime.NumCPU(), "parallelism level")
 	flagTimeout       = flag.Int("timeout", 10, "test timeout, in seconds")
+	flagMemLimit      = flag.Int("memlimit", 0, "memory limit for a single input, in MB (0 - no limit); inputs that exceed it are reported as crashers")
 	flagMinimize      = flag.Duration("minimize", 1*time.Minute, "time limit for input minimization")
+	flagSlow          = flag.Duration("slow", 0, "inputs that execute longer than this are reported as slow units (0 - 100x of average corpus input execution time, but at least 10ms)")
 	flagMaster        = flag.String("master", "", "master mode (value is master address)")
 	flagSlave         = flag.String("slave", "", "slave mode (value is master address)")
 	flagBin           = flag.String("bin", "", "test binary built with go-fuzz-build")
+	flagFunc          = flag.String("func", "", "fuzz function to test if the binary contains several (data is stored in workdir/func)")
 	flagDumpCover     = flag.Bool("dumpcover", false, "dump coverage profile into workdir")
 	flagDup           = flag.Bool("dup", false, "collect duplicate crashers")
+	flagCrashDepth    = flag.Int("crashdepth", 0, "number of stack frames used to bucket crashes (0 - all frames)")
 	flagTestOutput    = flag.Bool("testoutput", false, "print test binary output to stdout (for debugging only)")
 	flagCoverCounters = flag.Bool("covercounters", true, "use coverage hit counters")
 	flagSonar         = flag.Bool("sonar", true, "use sonar hints")
+	flagGrammar       = flag.String("grammar", "", "EBNF grammar file of inputs, used to generate and mutate inputs in addition to the versifier")
+	flagDict          = flag.String("dict", "", "dictionary file with tokens in AFL/libFuzzer format (files in workdir/dict are used as well)")
+	flagMinCorpus     = flag.Bool("minimize-corpus", false, "remove inputs that do not add coverage from workdir/corpus and exit")
+	flagRepro         = flag.String("repro", "", "execute the given input, print crash output and exit (exit status is 1 on crash)")
+	flagRegress       = flag.Bool("regress", false, "execute all inputs in workdir/corpus and workdir/crashers once, report crashes, hangs and fixed crashers and exit (exit status is 1 on crash)")
+	flagJUnit         = flag.String("junit", "", "file to write JUnit XML report of -regress to")
+	flagSchedule      = flag.String("schedule", "default", "corpus schedule: default, explore, fast, coe or rare")
+	flagHooks         = flag.Float64("hooks", 0.5, "fraction of fuzzing iterations that use FuzzMutate/FuzzPostProcess hooks of the test binary (if it has them)")
+	flagInProcess     = flag.Bool("inprocess", false, "do every other batch of random mutations inside of the test process (faster for cheap Fuzz functions; the in-process mutator does not use literals, dictionaries, typed arguments and splicing)")
+	flagDuration      = flag.Duration("duration", 0, "stop fuzzing after this time (0 - run until interrupted)")
+	flagMaxExecs      = flag.Uint64("max-execs", 0, "stop fuzzing after this number of executions (0 - no limit)")
+	flagStopStale     = flag.Duration("stop-after-stale", 0, "stop fuzzing if corpus did not grow for this time (0 - no limit)")
+	flagSummary       = flag.String("summary", "", "file to write JSON summary of the run to on exit (workdir/summary.json by default, workdir/regress.json with -regress)")
 	flagV             = flag.Int("v", 0, "verbosity level")
 	flagHTTP          = flag.String("http", "", "HTTP server listen address (master mode only)")
+	flagToken         = flag.String("token", "", "pre-shared token for master/slave authentication (GO_FUZZ_TOKEN env var is used if not set)")
+	flagTLSCert       = flag.String("tlscert", "", "TLS certificate file for master/slave connection")
+	flagTLSKey        = flag.String("tlskey", "", "TLS private key file for -tlscert")
+	flagTLSCA         = flag.String("tlsca", "", "CA certificate file to verify the other side of master/slave connection")
 
 	shutdown        uint32
 	shutdownC       = make(chan struct{})
 	shutdownCleanup []func()
+	shutdownReason  string // why fuzzing stopped, set before shutdownCleanup is executed
+	exitStatus      int    // set by shutdownCleanup functions
 )
 
 func main() {
@@ -48,19 +72,41 @@ func main() {
 	if *flagHTTP != "" && *flagSlave != "" {
 		log.Fatalf("both -http and -slave are specified")
 	}
+	if *flagFunc != "" && *flagWorkdir != "" {
+		// Every fuzz function has own corpus, crashers and suppressions.
+		*flagWorkdir = filepath.Join(*flagWorkdir, *flagFunc)
+	}
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "crashes":
+			crashesMain(flag.Args()[1:])
+		case "corpus":
+			corpusMain(flag.Args()[1:])
+		case "merge":
+			mergeMain(flag.Args()[1:])
+		default:
+			log.Fatalf("unknown command %v", flag.Arg(0))
+		}
+		return
+	}
+	if *flagRepro != "" {
+		reproMain(*flagRepro)
+		return
+	}
+	if *flagMinCorpus {
+		minimizeCorpusMain()
+		return
+	}
+	if *flagRegress {
+		regressMain()
+		return
+	}
 
 	go func() {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT)
 		<-c
-		atomic.StoreUint32(&shutdown, 1)
-		close(shutdownC)
-		log.Printf("shutting down...")
-		time.Sleep(2 * time.Second)
-		for _, f := range shutdownCleanup {
-			f()
-		}
-		os.Exit(0)
+		stopFuzzing("interrupted")
 	}()
 
 	runtime.GOMAXPROCS(min(*flagProcs, runtime.NumCPU()))
@@ -93,3 +139,20 @@ func main() {
 
 	select {}
 }
+
+// stopFuzzing shuts down master and slaves running in this process and exits.
+// Master shuts down the process when a limit (-duration, -max-execs or
+// -stop-after-stale) is reached, the process is also stopped by SIGINT.
+func stopFuzzing(reason string) {
+	if !atomic.CompareAndSwapUint32(&shutdown, 0, 1) {
+		return
+	}
+	close(shutdownC)
+	log.Printf("shutting down (%v)...", reason)
+	time.Sleep(2 * time.Second)
+	shutdownReason = reason
+	for _, f := range shutdownCleanup {
+		f()
+	}
+	os.Exit(exitStatus)
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
@@ -15,10 +16,14 @@ import (
 	"net/rpc"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+	"github.com/dvyukov/go-fuzz/go-fuzz/grammar"
 	"github.com/dvyukov/go-fuzz/go-fuzz/internal/writerset"
 )
 
@@ -30,6 +35,16 @@ type Master struct {
 	corpus       *PersistentSet
 	suppressions *PersistentSet
 	crashers     *PersistentSet
+	slow         *PersistentSet
+	slowSigs     *PersistentSet // slowSig's of inputs in slow
+	crashdb      *CrashDB
+	dict         [][]byte // tokens from dictionaries
+	grammar      []byte   // source of -grammar file
+	coverBlocks  []CoverBlock
+	coverFilter  InstrFilter
+	coverDirs    map[string]string // see MetaData.SourceDirs
+	coverInputs  map[int]Sig       // smallest corpus input for every covered CoverTab entry
+	metadataHash Sig               // all slaves must have binaries with the same metadata
 
 	startTime     time.Time
 	lastInput     time.Time
@@ -43,6 +58,8 @@ type Master struct {
 // MasterSlave represents master's view of a slave.
 type MasterSlave struct {
 	id       int
+	key      uint64
+	schedule string
 	procs    int
 	pending  []MasterInput
 	lastSync time.Time
@@ -56,24 +73,37 @@ func masterMain(ln net.Listener) {
 	m.lastInput = time.Now()
 	m.suppressions = newPersistentSet(filepath.Join(*flagWorkdir, "suppressions"))
 	m.crashers = newPersistentSet(filepath.Join(*flagWorkdir, "crashers"))
+	m.slow = newPersistentSet(filepath.Join(*flagWorkdir, "slow"))
+	m.slowSigs = newPersistentSet(filepath.Join(*flagWorkdir, "slowsigs"))
+	m.crashdb = newCrashDB(*flagWorkdir)
+	m.crashdb.save()
 	m.corpus = newPersistentSet(filepath.Join(*flagWorkdir, "corpus"))
 	if len(m.corpus.m) == 0 {
 		m.corpus.add(Artifact{[]byte{}, 0, false})
 	}
+	m.dict = loadDicts()
+	m.grammar = loadGrammar()
+	if *flagBin != "" {
+		m.metadataHash = metadataHash(loadMetadata(*flagBin))
+	}
 
 	m.slaves = make(map[int]*MasterSlave)
+	m.coverInputs = make(map[int]Sig)
+	shutdownCleanup = append(shutdownCleanup, m.writeSummary)
 	masterListen(m)
 
 	go masterLoop(m)
 
 	s := rpc.NewServer()
 	s.Register(m)
-	s.Accept(ln)
+	masterServe(ln, s)
 }
 
 func masterListen(m *Master) {
 	if *flagHTTP != "" {
 		http.HandleFunc("/eventsource", m.eventSource)
+		http.HandleFunc("/cover", m.coverReport)
+		http.HandleFunc("/input", m.input)
 		http.HandleFunc("/", m.index)
 
 		go func() {
@@ -99,15 +129,33 @@ func masterLoop(m *Master) {
 			log.Printf("slave %v died", s.id)
 			delete(m.slaves, id)
 		}
+		m.crashdb.save()
 		m.mu.Unlock()
 
-		m.broadcastStats()
+		stats := m.masterStats()
+		m.broadcastStats(stats)
+		if reason := limitReached(stats); reason != "" {
+			stopFuzzing(reason)
+			return
+		}
 	}
 }
 
-func (m *Master) broadcastStats() {
-	stats := m.masterStats()
+// limitReached returns why fuzzing must be stopped according to
+// -duration, -max-execs and -stop-after-stale flags (empty if it must not).
+func limitReached(stats masterStats) string {
+	switch {
+	case *flagDuration != 0 && time.Since(stats.StartTime) >= *flagDuration:
+		return "duration limit reached"
+	case *flagMaxExecs != 0 && stats.Execs >= *flagMaxExecs:
+		return "execs limit reached"
+	case *flagStopStale != 0 && time.Since(stats.LastNewInputTime) >= *flagStopStale:
+		return fmt.Sprintf("no new inputs for %v", *flagStopStale)
+	}
+	return ""
+}
 
+func (m *Master) broadcastStats(stats masterStats) {
 	// log to stdout
 	log.Println(stats.String())
 
@@ -141,11 +189,13 @@ func (m *Master) masterStats() masterStats {
 	stats := masterStats{
 		Corpus:           uint64(len(m.corpus.m)),
 		Crashers:         uint64(len(m.crashers.m)),
+		Slow:             uint64(len(m.slow.m)),
 		Uptime:           fmtDuration(time.Since(m.startTime)),
 		StartTime:        m.startTime,
 		LastNewInputTime: m.lastInput,
 		Execs:            m.statExecs,
 		Cover:            uint64(m.coverFullness),
+		Dict:             uint64(len(m.dict)),
 	}
 
 	// Print stats line.
@@ -153,25 +203,32 @@ func (m *Master) masterStats() masterStats {
 		stats.RestartsDenom = m.statExecs / m.statRestarts
 	}
 
+	schedules := make(map[string]bool)
 	for _, s := range m.slaves {
 		stats.Slaves += uint64(s.procs)
+		if s.schedule != "" && !schedules[s.schedule] {
+			schedules[s.schedule] = true
+			stats.Schedules = append(stats.Schedules, s.schedule)
+		}
 	}
+	sort.Strings(stats.Schedules)
 
 	return stats
 }
 
 type masterStats struct {
-	Slaves, Corpus, Crashers, Execs, Cover, RestartsDenom uint64
-	LastNewInputTime, StartTime                           time.Time
-	Uptime                                                string
+	Slaves, Corpus, Crashers, Slow, Execs, Cover, Dict, RestartsDenom uint64
+	LastNewInputTime, StartTime                                       time.Time
+	Uptime                                                            string
+	Schedules                                                         []string // corpus schedules used by slaves
 }
 
 func (s masterStats) String() string {
-	return fmt.Sprintf("slaves: %v, corpus: %v (%v ago), crashers: %v,"+
-		" restarts: 1/%v, execs: %v (%.0f/sec), cover: %v, uptime: %v",
+	return fmt.Sprintf("slaves: %v, corpus: %v (%v ago), crashers: %v, slow: %v,"+
+		" restarts: 1/%v, execs: %v (%.0f/sec), cover: %v, dict: %v, schedule: %v, uptime: %v",
 		s.Slaves, s.Corpus, fmtDuration(time.Since(s.LastNewInputTime)),
-		s.Crashers, s.RestartsDenom, s.Execs, s.ExecsPerSec(), s.Cover,
-		s.Uptime,
+		s.Crashers, s.Slow, s.RestartsDenom, s.Execs, s.ExecsPerSec(), s.Cover,
+		s.Dict, strings.Join(s.Schedules, ","), s.Uptime,
 	)
 }
 
@@ -190,12 +247,21 @@ func fmtDuration(d time.Duration) string {
 }
 
 type ConnectArgs struct {
-	Procs int
+	ID           int    // ID of a reconnecting slave (0 for a new slave)
+	Key          uint64 // random slave key to distinguish slaves with the same ID
+	Procs        int
+	Schedule     string       // corpus schedule used by the slave
+	Blocks       []CoverBlock // coverage metadata of the test binary
+	Filter       InstrFilter  // packages and files the blocks are collected for
+	SourceDirs   map[string]string
+	MetadataHash Sig
 }
 
 type ConnectRes struct {
-	ID     int
-	Corpus []MasterInput
+	ID      int
+	Corpus  []MasterInput
+	Dict    [][]byte
+	Grammar []byte // source of the grammar (empty if there is none)
 }
 
 // MasterInput is description of input that is passed between master and slave.
@@ -212,14 +278,44 @@ func (m *Master) Connect(a *ConnectArgs, r *ConnectRes) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.idSeq++
+	if m.metadataHash == (Sig{}) {
+		// Master was started without -bin, the first slave determines the binary.
+		m.metadataHash = a.MetadataHash
+	} else if m.metadataHash != a.MetadataHash {
+		return errors.New("slave binary does not match master binary (rebuild or restart master)")
+	}
+	id := a.ID
+	if old := m.slaves[id]; id == 0 || old != nil && old.key != a.Key {
+		// New slave, or the ID is taken by another slave after master restart.
+		for {
+			m.idSeq++
+			if m.slaves[m.idSeq] == nil {
+				break
+			}
+		}
+		id = m.idSeq
+	} else if m.idSeq < id {
+		// Returning slave after master restart, don't give its ID to new slaves.
+		m.idSeq = id
+	}
+	// Returning slave receives whole corpus instead of the pending inputs,
+	// it will skip inputs it already has.
 	s := &MasterSlave{
-		id:       m.idSeq,
+		id:       id,
+		key:      a.Key,
+		schedule: a.Schedule,
 		procs:    a.Procs,
 		lastSync: time.Now(),
 	}
 	m.slaves[s.id] = s
+	if len(a.Blocks) != 0 {
+		m.coverBlocks = a.Blocks
+		m.coverFilter = a.Filter
+		m.coverDirs = a.SourceDirs
+	}
 	r.ID = s.id
+	r.Dict = m.dict
+	r.Grammar = m.grammar
 	// Give the slave initial corpus.
 	for _, a := range m.corpus.m {
 		r.Corpus = append(r.Corpus, MasterInput{a.data, a.meta, execCorpus, !a.user, true})
@@ -261,6 +357,8 @@ type NewCrasherArgs struct {
 	Error       []byte
 	Suppression []byte
 	Hanging     bool
+	OOM         bool // input exceeds memory limit (-memlimit)
+	Checked     bool // crash happened in the checked binary (go-fuzz-build -race/-checkedflags)
 }
 
 // NewCrasher saves new crasher input on master.
@@ -268,7 +366,10 @@ func (m *Master) NewCrasher(a *NewCrasherArgs, r *int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if !*flagDup && !m.suppressions.add(Artifact{a.Suppression, 0, false}) {
+	// Save the crasher if it is the first in its bucket or is smaller than the current reproducer.
+	// The database is saved periodically by masterLoop.
+	save := m.crashdb.add(a.Suppression, a.Data, time.Now())
+	if !*flagDup && !m.suppressions.add(Artifact{a.Suppression, 0, false}) && !save {
 		return nil // Already have this.
 	}
 	if !m.crashers.add(Artifact{a.Data, 0, false}) {
@@ -276,22 +377,127 @@ func (m *Master) NewCrasher(a *NewCrasherArgs, r *int) error {
 	}
 
 	// Prepare quoted version of input to simplify creation of standalone reproducers.
+	m.crashers.addDescription(a.Data, quoteData(a.Data), "quoted")
+	m.crashers.addDescription(a.Data, a.Error, "output")
+
+	return nil
+}
+
+// Summary is written to the -summary file when master exits.
+type Summary struct {
+	Reason      string // why fuzzing stopped
+	Seconds     float64
+	Corpus      uint64
+	Cover       uint64
+	Execs       uint64
+	Crashers    uint64           // total number of crashers in workdir
+	Slow        uint64           // total number of slow inputs in workdir
+	NewCrashers []SummaryCrasher // crash buckets first seen during the run
+}
+
+type SummaryCrasher struct {
+	Bucket  string
+	Title   string
+	Hits    uint64
+	Crasher string // file with the smallest reproducer
+}
+
+// writeSummary writes summary of the run on exit and sets non-zero exit status
+// if new crashers were found (crashers of suppressed crashes are never reported to master).
+func (m *Master) writeSummary() {
+	stats := m.masterStats()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sum := Summary{
+		Reason:   shutdownReason,
+		Seconds:  time.Since(m.startTime).Seconds(),
+		Corpus:   stats.Corpus,
+		Cover:    stats.Cover,
+		Execs:    stats.Execs,
+		Crashers: stats.Crashers,
+		Slow:     stats.Slow,
+
+		NewCrashers: []SummaryCrasher{},
+	}
+	m.crashdb.save()
+	for _, id := range m.crashdb.sorted() {
+		b := m.crashdb.Buckets[id]
+		if b.FirstSeen.Before(m.startTime) {
+			continue
+		}
+		sum.NewCrashers = append(sum.NewCrashers, SummaryCrasher{
+			Bucket:  id,
+			Title:   b.Title,
+			Hits:    b.Hits,
+			Crasher: filepath.Join(*flagWorkdir, "crashers", b.Crasher),
+		})
+	}
+	if len(sum.NewCrashers) != 0 {
+		log.Printf("found %v new crashers", len(sum.NewCrashers))
+		exitStatus = 1
+	}
+	data, err := json.MarshalIndent(sum, "", "\t")
+	if err != nil {
+		log.Fatalf("failed to marshal summary: %v", err)
+	}
+	file := *flagSummary
+	if file == "" {
+		file = filepath.Join(*flagWorkdir, "summary.json")
+	}
+	if err := ioutil.WriteFile(file, append(data, '\n'), 0660); err != nil {
+		log.Printf("failed to write summary: %v", err)
+	}
+}
+
+type NewSlowArgs struct {
+	Data      []byte
+	Ns        uint64 // execution time of the input
+	Threshold uint64 // slowness threshold at the time of detection
+	AvgNs     uint64 // average execution time of corpus inputs
+	Sigs      []Sig  // slowSig's of the original and the minimized input
+}
+
+// NewSlow saves new slow input on master along with timing data.
+func (m *Master) NewSlow(a *NewSlowArgs, r *int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Different slaves (or the same slave after restart) report different
+	// inputs that cover the same code, keep only the first one.
+	known := len(a.Sigs) != 0
+	for _, sig := range a.Sigs {
+		if m.slowSigs.add(Artifact{makeCopy(sig[:]), 0, false}) {
+			known = false
+		}
+	}
+	if known {
+		return nil
+	}
+	if !m.slow.add(Artifact{a.Data, 0, false}) {
+		return nil // Already have this.
+	}
+	m.slow.addDescription(a.Data, quoteData(a.Data), "quoted")
+	timing := fmt.Sprintf("exec time: %v\nthreshold: %v\ncorpus average: %v\n",
+		time.Duration(a.Ns), time.Duration(a.Threshold), time.Duration(a.AvgNs))
+	m.slow.addDescription(a.Data, []byte(timing), "timing")
+	return nil
+}
+
+// quoteData formats data as a Go string literal split into several lines.
+func quoteData(data []byte) []byte {
 	var buf bytes.Buffer
-	for i := 0; i < len(a.Data); i += 20 {
+	for i := 0; i < len(data); i += 20 {
 		e := i + 20
-		if e > len(a.Data) {
-			e = len(a.Data)
+		if e > len(data) {
+			e = len(data)
 		}
-		fmt.Fprintf(&buf, "\t%q", a.Data[i:e])
-		if e != len(a.Data) {
+		fmt.Fprintf(&buf, "\t%q", data[i:e])
+		if e != len(data) {
 			fmt.Fprintf(&buf, " +")
 		}
 		fmt.Fprintf(&buf, "\n")
 	}
-	m.crashers.addDescription(a.Data, buf.Bytes(), "quoted")
-	m.crashers.addDescription(a.Data, a.Error, "output")
-
-	return nil
+	return buf.Bytes()
 }
 
 type SyncArgs struct {
@@ -299,6 +505,8 @@ type SyncArgs struct {
 	Execs         uint64
 	Restarts      uint64
 	CoverFullness int
+	CrashHits     map[Sig]uint64 // number of suppressed crashes per suppression
+	CoverInputs   map[int]Sig    // changes in smallest inputs for CoverTab entries
 }
 
 type SyncRes struct {
@@ -322,8 +530,38 @@ func (m *Master) Sync(a *SyncArgs, r *SyncRes) error {
 	if m.coverFullness < a.CoverFullness {
 		m.coverFullness = a.CoverFullness
 	}
+	for sig, n := range a.CrashHits {
+		m.crashdb.hit(sig, n)
+	}
+	for idx, sig := range a.CoverInputs {
+		cur, ok := m.coverInputs[idx]
+		if ok {
+			a0, ok0 := m.corpus.m[cur]
+			a1, ok1 := m.corpus.m[sig]
+			if ok0 && (!ok1 || len(a0.data) <= len(a1.data)) {
+				continue
+			}
+		}
+		m.coverInputs[idx] = sig
+	}
 	s.lastSync = time.Now()
 	r.Inputs = s.pending
 	s.pending = nil
 	return nil
 }
+
+// loadGrammar reads grammar file specified with -grammar flag
+// and checks that it is correct. Slaves receive the grammar source from master.
+func loadGrammar() []byte {
+	if *flagGrammar == "" {
+		return nil
+	}
+	src, err := ioutil.ReadFile(*flagGrammar)
+	if err != nil {
+		log.Fatalf("failed to read grammar: %v", err)
+	}
+	if _, err := grammar.Parse(src); err != nil {
+		log.Fatalf("failed to parse grammar %v: %v", *flagGrammar, err)
+	}
+	return src
+}
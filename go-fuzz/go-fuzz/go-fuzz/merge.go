@@ -0,0 +1,190 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mergeMain implements merging of workdirs from several machines into one:
+//
+//	go-fuzz -bin=./pkg-fuzz.zip merge -o outdir indir1 indir2...
+//
+// Corpus inputs are merged by coverage: all inputs (including inputs already
+// in outdir) are executed and only inputs that add to the total coverage are kept.
+// Crashers and suppressions are united, crashers are re-bucketed by their
+// suppression, so the same crash found on different machines ends up
+// in a single bucket with the smallest reproducer. Slow inputs and their
+// coverage signatures are united as well.
+func mergeMain(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	flagOut := fs.String("o", "", "output workdir (can be one of input workdirs)")
+	fs.Parse(args)
+	if *flagOut == "" || fs.NArg() == 0 {
+		log.Fatalf("usage: go-fuzz -bin=./pkg-fuzz.zip merge -o outdir indir1 indir2...")
+	}
+	if *flagBin == "" {
+		log.Fatalf("-bin is not set")
+	}
+	out := *flagOut
+	dirs := fs.Args()
+	if *flagFunc != "" {
+		out = filepath.Join(out, *flagFunc)
+		for i, dir := range dirs {
+			dirs[i] = filepath.Join(dir, *flagFunc)
+		}
+	}
+	if err := os.MkdirAll(out, 0770); err != nil {
+		log.Fatalf("failed to create dir: %v", err)
+	}
+	var inputDirs []string
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); err != nil {
+			log.Fatalf("bad input workdir: %v", err)
+		}
+		// Contents of the output workdir are merged anyway,
+		// merging it with itself would count crash hits twice.
+		if sameDir(dir, out) {
+			continue
+		}
+		inputDirs = append(inputDirs, dir)
+	}
+	dirs = inputDirs
+
+	coverBin, sonarBin, checkedBin, metadata := unpackBinary(*flagBin)
+	defer os.Remove(coverBin)
+	os.Remove(sonarBin)
+	if checkedBin != "" {
+		os.Remove(checkedBin)
+	}
+	bin := newTestBinary(coverBin, selectFuzzFunc(metadata.Funcs), func() {}, &Stats{})
+	defer bin.close()
+
+	// Corpus.
+	corpusDir := filepath.Join(out, "corpus")
+	corpus := newPersistentSet(corpusDir)
+	inputs := make(map[Sig]Artifact)
+	for sig, a := range corpus.m {
+		inputs[sig] = a
+	}
+	for _, dir := range dirs {
+		for sig, a := range newPersistentSet(filepath.Join(dir, "corpus")).m {
+			if _, ok := inputs[sig]; !ok {
+				inputs[sig] = a
+			}
+		}
+	}
+	var data [][]byte
+	for _, a := range inputs {
+		data = append(data, a.data)
+	}
+	keep, cover := minimizeInputs(bin, data)
+	for sig := range keep {
+		a := inputs[sig]
+		a.user = false
+		corpus.add(a)
+	}
+	removed := pruneDir(corpusDir, keep)
+	log.Printf("corpus: %v inputs from %v workdirs, kept %v (removed %v from %v), cover: %v",
+		len(inputs), len(dirs), len(keep), removed, corpusDir, updateMaxCover(make([]byte, coverRegionSize), cover))
+
+	// Crashers and suppressions.
+	crashers := newPersistentSet(filepath.Join(out, "crashers"))
+	suppressions := newPersistentSet(filepath.Join(out, "suppressions"))
+	db := newCrashDB(out)
+	nbuckets := len(db.Buckets)
+	for _, dir := range dirs {
+		for _, a := range newPersistentSet(filepath.Join(dir, "suppressions")).m {
+			suppressions.add(Artifact{a.data, 0, false})
+		}
+		mergeCrashers(db, crashers, suppressions, dir)
+	}
+	db.save()
+	log.Printf("crashers: %v, buckets: %v (%v new)", len(crashers.m), len(db.Buckets), len(db.Buckets)-nbuckets)
+
+	// Slow inputs.
+	slow := newPersistentSet(filepath.Join(out, "slow"))
+	slowSigs := newPersistentSet(filepath.Join(out, "slowsigs"))
+	nslow := len(slow.m)
+	for _, dir := range dirs {
+		for _, a := range newPersistentSet(filepath.Join(dir, "slowsigs")).m {
+			slowSigs.add(Artifact{a.data, 0, false})
+		}
+		copyArtifacts(slow, filepath.Join(dir, "slow"), "quoted", "timing")
+	}
+	log.Printf("slow: %v (%v new)", len(slow.m), len(slow.m)-nslow)
+}
+
+// copyArtifacts adds artifacts from dir to ps along with their descriptions of the given types.
+func copyArtifacts(ps *PersistentSet, dir string, types ...string) {
+	for sig, a := range newPersistentSet(dir).m {
+		if !ps.add(Artifact{a.data, 0, false}) {
+			continue
+		}
+		name := filepath.Join(dir, hex.EncodeToString(sig[:]))
+		for _, typ := range types {
+			if desc, err := ioutil.ReadFile(name + "." + typ); err == nil {
+				ps.addDescription(a.data, desc, typ)
+			}
+		}
+	}
+}
+
+// sameDir returns true if dir1 and dir2 refer to the same existing directory.
+func sameDir(dir1, dir2 string) bool {
+	info1, err1 := os.Stat(dir1)
+	info2, err2 := os.Stat(dir2)
+	return err1 == nil && err2 == nil && os.SameFile(info1, info2)
+}
+
+// mergeCrashers copies crashers from workdir dir along with their descriptions
+// and adds them to db. Buckets are recomputed from crash output,
+// so crashers bucketed differently in dir (e.g. with different -crashdepth)
+// are grouped in the same way as crashers found locally.
+func mergeCrashers(db *CrashDB, crashers, suppressions *PersistentSet, dir string) {
+	other := newCrashDB(dir)
+	reproducers := make(map[string]string)
+	for id, b := range other.Buckets {
+		reproducers[b.Crasher] = id
+	}
+	for sig, a := range newPersistentSet(filepath.Join(dir, "crashers")).m {
+		crasher := hex.EncodeToString(sig[:])
+		name := filepath.Join(dir, "crashers", crasher)
+		crashers.add(Artifact{a.data, 0, false})
+		for _, typ := range []string{"output", "quoted"} {
+			if desc, err := ioutil.ReadFile(name + "." + typ); err == nil {
+				crashers.addDescription(a.data, desc, typ)
+			}
+		}
+		output, err := ioutil.ReadFile(name + ".output")
+		if err != nil {
+			continue // user-provided crasher, it is not bucketed
+		}
+		supp := extractSuppression(output)
+		suppressions.add(Artifact{supp, 0, false})
+		id := hash(supp)
+		if otherID, ok := reproducers[crasher]; ok {
+			b1 := *other.Buckets[otherID]
+			b1.Signature = string(supp)
+			b1.Title = strings.SplitN(b1.Signature, "\n", 2)[0]
+			db.merge(bucketSource(dir, otherID), hex.EncodeToString(id[:]), &b1)
+			continue
+		}
+		// Not the smallest reproducer in dir, but it can be the first
+		// or the smallest one after re-bucketing.
+		if b := db.Buckets[hex.EncodeToString(id[:])]; b == nil || len(a.data) < b.Size {
+			info, err := os.Stat(name + ".output")
+			if err != nil {
+				continue
+			}
+			db.add(supp, a.data, info.ModTime())
+		}
+	}
+}
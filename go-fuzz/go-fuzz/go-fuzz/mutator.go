@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"sort"
 	"strconv"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -26,17 +27,32 @@ func (m *Mutator) rand(n int) int {
 }
 
 func (m *Mutator) generate(ro *ROData) ([]byte, int) {
+	input := m.chooseInput(ro)
+	return m.mutate(input.data, ro), input.depth + 1
+}
+
+// chooseInput chooses a corpus input for mutation according to input scores.
+func (m *Mutator) chooseInput(ro *ROData) *Input {
 	corpus := ro.corpus
 	scoreSum := corpus[len(corpus)-1].runningScoreSum
 	weightedIdx := m.rand(scoreSum)
 	idx := sort.Search(len(corpus), func(i int) bool {
 		return corpus[i].runningScoreSum > weightedIdx
 	})
-	input := &corpus[idx]
-	return m.mutate(input.data, ro), input.depth + 1
+	if corpus[idx].picked != nil {
+		atomic.AddUint64(corpus[idx].picked, 1)
+	}
+	return &corpus[idx]
 }
 
 func (m *Mutator) mutate(data []byte, ro *ROData) []byte {
+	if ro.args != nil && m.rand(2) == 0 {
+		return m.mutateTyped(data, ro)
+	}
+	return m.mutateBytes(data, ro)
+}
+
+func (m *Mutator) mutateBytes(data []byte, ro *ROData) []byte {
 	corpus := ro.corpus
 	res := make([]byte, len(data))
 	copy(res, data)
@@ -45,7 +61,7 @@ func (m *Mutator) mutate(data []byte, ro *ROData) []byte {
 		nm++
 	}
 	for iter := 0; iter < nm; iter++ {
-		switch m.rand(20) {
+		switch m.rand(22) {
 		case 0:
 			// Remove a range of bytes.
 			if len(res) <= 1 {
@@ -386,6 +402,32 @@ func (m *Mutator) mutate(data []byte, ro *ROData) []byte {
 			}
 			pos := m.rand(len(res) - len(lit))
 			copy(res[pos:], lit)
+		case 20:
+			// Insert a dictionary token.
+			if len(ro.dict) == 0 {
+				iter--
+				continue
+			}
+			tok := ro.dict[m.rand(len(ro.dict))]
+			pos := m.rand(len(res) + 1)
+			for i := 0; i < len(tok); i++ {
+				res = append(res, 0)
+			}
+			copy(res[pos+len(tok):], res[pos:])
+			copy(res[pos:], tok)
+		case 21:
+			// Replace with a dictionary token.
+			if len(ro.dict) == 0 {
+				iter--
+				continue
+			}
+			tok := ro.dict[m.rand(len(ro.dict))]
+			if len(tok) >= len(res) {
+				iter--
+				continue
+			}
+			pos := m.rand(len(res) - len(tok))
+			copy(res[pos:], tok)
 		}
 	}
 	if len(res) > MaxInputSize {
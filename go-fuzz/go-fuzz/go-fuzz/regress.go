@@ -0,0 +1,277 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+// RegressReport is the result of -regress run, it is written to the -summary file.
+type RegressReport struct {
+	Time    time.Time
+	Func    string
+	Passed  int // corpus inputs that don't crash
+	Fixed   int // crashers that don't crash anymore
+	Crashed int // crashers that still crash and corpus inputs that now crash
+	Hanged  int
+	Results []RegressResult
+}
+
+type RegressResult struct {
+	Kind      string // "corpus" or "crashers"
+	Input     string // hash of the input (file name if the input was saved by go-fuzz)
+	Status    string // "ok", "fixed", "crash" or "hang"
+	Title     string `json:",omitempty"` // first line of crash message
+	Bucket    string `json:",omitempty"` // crash bucket ID, see CrashDB
+	NewBucket bool   `json:",omitempty"` // the bucket is not present in workdir/crashdb.json
+	Seconds   float64
+	Output    string `json:",omitempty"`
+}
+
+func (r *RegressResult) failed() bool {
+	return r.Status == "crash" || r.Status == "hang"
+}
+
+// regressMain implements -regress mode: it executes all inputs in workdir/corpus
+// and workdir/crashers once, without mutations, and reports which crashers still
+// reproduce, which are fixed and which corpus inputs now crash or hang.
+// Exit status is 1 if any input crashes or hangs.
+func regressMain() {
+	if *flagWorkdir == "" {
+		log.Fatalf("-workdir is not set")
+	}
+	if *flagBin == "" {
+		log.Fatalf("-bin is not set")
+	}
+	coverBin, sonarBin, checkedBin, metadata := unpackBinary(*flagBin)
+	defer os.Remove(coverBin)
+	os.Remove(sonarBin)
+	if checkedBin != "" {
+		defer os.Remove(checkedBin)
+	}
+	funcIdx := selectFuzzFunc(metadata.Funcs)
+	crashdb := newCrashDB(*flagWorkdir)
+
+	type regressInput struct {
+		kind string
+		sig  Sig
+		data []byte
+	}
+	var inputs []regressInput
+	for _, kind := range []string{"corpus", "crashers"} {
+		ps := newPersistentSet(filepath.Join(*flagWorkdir, kind))
+		for sig, a := range ps.m {
+			inputs = append(inputs, regressInput{kind, sig, a.data})
+		}
+	}
+	log.Printf("replaying %v inputs", len(inputs))
+
+	results := make([]RegressResult, len(inputs))
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for p := 0; p < *flagProcs; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bin := newTestBinary(coverBin, funcIdx, func() {}, &Stats{})
+			defer bin.close()
+			var checked *TestBinary
+			for i := range idx {
+				inp := inputs[i]
+				data := inp.data
+				if len(data) > MaxInputSize {
+					data = data[:MaxInputSize]
+				}
+				start := time.Now()
+				_, _, _, _, output, crashed, hanged := bin.test(data)
+				if !crashed && checkedBin != "" {
+					// The crash can be reproducible only with checked binary (e.g. a data race).
+					if checked == nil {
+						checked = newCheckedTestBinary(checkedBin, funcIdx, func() {}, &Stats{})
+						defer checked.close()
+					}
+					_, _, _, _, output, crashed, hanged = checked.test(data)
+				}
+				res := RegressResult{
+					Kind:    inp.kind,
+					Input:   hex.EncodeToString(inp.sig[:]),
+					Status:  "ok",
+					Seconds: time.Since(start).Seconds(),
+				}
+				switch {
+				case crashed:
+					supp := extractSuppression(output)
+					sig := hash(supp)
+					res.Bucket = hex.EncodeToString(sig[:])
+					res.Title = strings.SplitN(string(supp), "\n", 2)[0]
+					res.NewBucket = crashdb.Buckets[res.Bucket] == nil
+					res.Output = string(output)
+					res.Status = "crash"
+					if hanged {
+						res.Status = "hang"
+					}
+				case inp.kind == "crashers":
+					res.Status = "fixed"
+				}
+				results[i] = res
+			}
+		}()
+	}
+	for i := range inputs {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+
+	sort.Sort(regressSorter(results))
+	rep := RegressReport{
+		Time:    time.Now(),
+		Results: results,
+	}
+	if funcIdx < len(metadata.Funcs) {
+		rep.Func = metadata.Funcs[funcIdx]
+	}
+	for i := range results {
+		res := &results[i]
+		switch res.Status {
+		case "ok":
+			rep.Passed++
+		case "fixed":
+			rep.Fixed++
+		case "crash":
+			rep.Crashed++
+		case "hang":
+			rep.Hanged++
+		}
+		if res.failed() {
+			fmt.Printf("%v/%v: %v: %v\n", res.Kind, res.Input, res.Status, res.Title)
+		}
+	}
+	log.Printf("regress: %v inputs ok, %v crashers fixed, %v crashed, %v hanged",
+		rep.Passed, rep.Fixed, rep.Crashed, rep.Hanged)
+
+	data, err := json.MarshalIndent(rep, "", "\t")
+	if err != nil {
+		log.Fatalf("failed to marshal regress results: %v", err)
+	}
+	file := *flagSummary
+	if file == "" {
+		file = filepath.Join(*flagWorkdir, "regress.json")
+	}
+	if err := ioutil.WriteFile(file, append(data, '\n'), 0660); err != nil {
+		log.Fatalf("failed to write regress results: %v", err)
+	}
+	if *flagJUnit != "" {
+		if err := ioutil.WriteFile(*flagJUnit, junitReport(&rep), 0660); err != nil {
+			log.Fatalf("failed to write JUnit report: %v", err)
+		}
+	}
+	if rep.Crashed != 0 || rep.Hanged != 0 {
+		os.Exit(1)
+	}
+}
+
+type regressSorter []RegressResult
+
+func (s regressSorter) Len() int {
+	return len(s)
+}
+
+func (s regressSorter) Less(i, j int) bool {
+	if s[i].Kind != s[j].Kind {
+		return s[i].Kind < s[j].Kind
+	}
+	return s[i].Input < s[j].Input
+}
+
+func (s regressSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",cdata"`
+}
+
+// junitReport converts regress results to JUnit XML with one test suite
+// for corpus and one for crashers, every input is a test case.
+func junitReport(rep *RegressReport) []byte {
+	var suites junitTestSuites
+	for _, kind := range []string{"corpus", "crashers"} {
+		suite := junitTestSuite{
+			Name:      "go-fuzz/" + kind,
+			Timestamp: rep.Time.Format("2006-01-02T15:04:05"),
+		}
+		if rep.Func != "" {
+			suite.Name = fmt.Sprintf("go-fuzz/%v/%v", rep.Func, kind)
+		}
+		total := 0.0
+		for _, res := range rep.Results {
+			if res.Kind != kind {
+				continue
+			}
+			tc := junitTestCase{
+				Classname: suite.Name,
+				Name:      res.Input,
+				Time:      fmt.Sprintf("%.3f", res.Seconds),
+			}
+			if res.failed() {
+				suite.Failures++
+				tc.Failure = &junitFailure{
+					Message: res.Title,
+					Type:    res.Status,
+					Body:    res.Output,
+				}
+			} else if res.Status == "fixed" {
+				tc.SystemOut = "crasher does not reproduce anymore"
+			}
+			suite.Tests++
+			total += res.Seconds
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suite.Time = fmt.Sprintf("%.3f", total)
+		suites.Suites = append(suites.Suites, suite)
+	}
+	data, err := xml.MarshalIndent(suites, "", "\t")
+	if err != nil {
+		log.Fatalf("failed to marshal JUnit report: %v", err)
+	}
+	return append([]byte(xml.Header), append(data, '\n')...)
+}
@@ -0,0 +1,52 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+// reproMain implements -repro mode: it executes a single input and prints
+// crash output and suppression. Exit status is 1 if the input crashes,
+// so it can be used to check that a crasher is fixed.
+func reproMain(file string) {
+	if *flagBin == "" {
+		log.Fatalf("-bin is not set")
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalf("failed to read input: %v", err)
+	}
+	if len(data) > MaxInputSize {
+		log.Fatalf("input is too large (%v bytes, max %v)", len(data), MaxInputSize)
+	}
+	coverBin, sonarBin, checkedBin, metadata := unpackBinary(*flagBin)
+	os.Remove(sonarBin)
+	funcIdx := selectFuzzFunc(metadata.Funcs)
+	bin := newTestBinary(coverBin, funcIdx, func() {}, &Stats{})
+	res, _, _, _, output, crashed, _ := bin.test(data)
+	bin.close()
+	os.Remove(coverBin)
+	if checkedBin != "" {
+		// The crash can be reproducible only with checked binary (e.g. a data race).
+		if !crashed {
+			bin = newCheckedTestBinary(checkedBin, funcIdx, func() {}, &Stats{})
+			res, _, _, _, output, crashed, _ = bin.test(data)
+			bin.close()
+		}
+		os.Remove(checkedBin)
+	}
+	if !crashed {
+		fmt.Printf("no crash (result %v)\n", res)
+		return
+	}
+	fmt.Printf("%s\n", output)
+	fmt.Printf("suppression:\n%s\n", extractSuppression(output))
+	os.Exit(1)
+}
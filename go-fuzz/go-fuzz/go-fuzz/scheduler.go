@@ -0,0 +1,141 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+)
+
+// Scheduler decides how much fuzzing time every corpus input gets.
+// Inputs are chosen for mutation with probability proportional to their score.
+type Scheduler interface {
+	// Score returns score of the input. When it is called inp.base
+	// contains the base score (see baseScore) and inp.favored is set
+	// for a minimal set of inputs that give full corpus coverage.
+	Score(inp *Input, ctx *scheduleContext) float64
+	// Dynamic returns true if the schedule uses fuzzing statistics
+	// (number of times an input was picked and number of times coverage
+	// entries were hit). Such statistics are collected only for dynamic
+	// schedules and scores are periodically recalculated.
+	Dynamic() bool
+}
+
+// scheduleContext holds corpus-wide data for score calculation.
+type scheduleContext struct {
+	avgExecTime  uint64
+	avgCoverSize uint64
+	avgFreq      float64 // average freq of corpus inputs (dynamic schedules only)
+}
+
+// edgeHitsPeriod is the sampling period for coverage entry hit counts:
+// hits are counted for every edgeHitsPeriod-th execution.
+const edgeHitsPeriod = 16
+
+// pickUnit is the number of picks of an input that AFLFast schedules
+// treat as one fuzzing round of the input.
+const pickUnit = 1 << 10
+
+var schedulers = map[string]Scheduler{
+	"default": defaultScheduler{},
+	"explore": exploreScheduler{},
+	"fast":    fastScheduler{},
+	"coe":     coeScheduler{},
+	"rare":    rareScheduler{},
+}
+
+func newScheduler(name string) Scheduler {
+	s := schedulers[name]
+	if s == nil {
+		var names []string
+		for n := range schedulers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		log.Fatalf("unknown schedule %v, available schedules: %v", name, strings.Join(names, ", "))
+	}
+	return s
+}
+
+// defaultScheduler fuzzes only favored inputs (others receive minimal score)
+// according to their base score.
+type defaultScheduler struct{}
+
+func (defaultScheduler) Score(inp *Input, ctx *scheduleContext) float64 {
+	if !inp.favored {
+		return minScore
+	}
+	return float64(inp.base)
+}
+
+func (defaultScheduler) Dynamic() bool {
+	return false
+}
+
+// exploreScheduler distributes energy according to base scores
+// over all inputs, including non-favored ones.
+type exploreScheduler struct{}
+
+func (exploreScheduler) Score(inp *Input, ctx *scheduleContext) float64 {
+	return float64(inp.base)
+}
+
+func (exploreScheduler) Dynamic() bool {
+	return false
+}
+
+// fastScheduler is AFLFast "fast" schedule: energy grows exponentially
+// with the number of times the input was fuzzed, and is inversely
+// proportional to frequency of the input coverage.
+// It quickly moves energy away from high-frequency paths.
+type fastScheduler struct{}
+
+func (fastScheduler) Score(inp *Input, ctx *scheduleContext) float64 {
+	if !inp.favored {
+		return minScore
+	}
+	return float64(inp.base) * rounds(inp) * ctx.avgFreq / float64(inp.freq)
+}
+
+func (fastScheduler) Dynamic() bool {
+	return true
+}
+
+// coeScheduler is AFLFast "cut-off exponential" schedule: inputs with coverage
+// frequency above average are not fuzzed at all (receive minimal score),
+// energy of the rest grows exponentially with the number of times they were fuzzed.
+type coeScheduler struct{}
+
+func (coeScheduler) Score(inp *Input, ctx *scheduleContext) float64 {
+	if !inp.favored || float64(inp.freq) > ctx.avgFreq {
+		return minScore
+	}
+	return float64(inp.base) * rounds(inp)
+}
+
+func (coeScheduler) Dynamic() bool {
+	return true
+}
+
+// rareScheduler gives more energy to inputs that hit rare coverage entries
+// (FairFuzz-style), regardless of whether they are favored or not.
+type rareScheduler struct{}
+
+func (rareScheduler) Score(inp *Input, ctx *scheduleContext) float64 {
+	return float64(inp.base) * ctx.avgFreq / float64(inp.freq)
+}
+
+func (rareScheduler) Dynamic() bool {
+	return true
+}
+
+// rounds returns 2^s where s is the number of fuzzing rounds of the input.
+func rounds(inp *Input) float64 {
+	s := inp.picks() / pickUnit
+	if s > 16 {
+		s = 16
+	}
+	return float64(uint64(1) << s)
+}
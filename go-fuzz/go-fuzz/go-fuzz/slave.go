@@ -18,6 +18,7 @@ import (
 	"unsafe"
 
 	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+	"github.com/dvyukov/go-fuzz/go-fuzz/grammar"
 )
 
 const (
@@ -28,24 +29,43 @@ const (
 	execTriageInput
 	execFuzz
 	execVersifier
+	execGrammar
 	execSmash
 	execSonar
 	execSonarHint
+	execCustom
+	execChecked
 	execTotal
 	execCount
 )
 
+// minSlowTime is the minimal execution time of slow inputs
+// when the threshold is derived from the corpus average (see -slow).
+const minSlowTime = uint64(10 * time.Millisecond)
+
+// inProcessIters is the number of inputs the testee executes per in-process batch.
+// Hang detection works per batch, so it must be small enough to not trigger timeouts.
+const inProcessIters = 100
+
 // Slave manages one testee.
 type Slave struct {
 	id      int
 	hub     *Hub
 	mutator *Mutator
 
-	coverBin *TestBinary
-	sonarBin *TestBinary
+	coverBin   *TestBinary
+	sonarBin   *TestBinary
+	checkedBin *TestBinary // nil if the archive does not contain checked binary
+
+	checkedPos  int       // position in corpus of the next input for checkedBin
+	checkedNext time.Time // time of the next execution of checkedBin
+
+	hooks int // Hook* functions present in the test binary
 
 	triageQueue  []MasterInput
 	crasherQueue []NewCrasherArgs
+	slowQueue    []NewSlowArgs
+	slowSeen     map[Sig]struct{}
 
 	lastSync time.Time
 	stats    Stats
@@ -62,17 +82,65 @@ type Input struct {
 	typ             int
 	execTime        uint64
 	favored         bool
+	picked          *uint64 // number of times the input was chosen for mutation
+	freq            uint64  // see inputFreq (dynamic schedules only)
+	base            int     // see baseScore
 	score           int
 	runningScoreSum int
 }
 
 func slaveMain() {
-	zipr, err := zip.OpenReader(*flagBin)
+	coverBin, sonarBin, checkedBin, metadata := unpackBinary(*flagBin)
+	funcIdx := selectFuzzFunc(metadata.Funcs)
+
+	shutdownCleanup = append(shutdownCleanup, func() {
+		os.Remove(coverBin)
+		os.Remove(sonarBin)
+		if checkedBin != "" {
+			os.Remove(checkedBin)
+		}
+	})
+	if checkedBin != "" && *flagV >= 1 {
+		log.Printf("corpus inputs are re-executed with checked binary (%v)", metadata.Checked)
+	}
+	if *flagHooks < 0 || *flagHooks > 1 {
+		log.Fatalf("-hooks must be in [0, 1] range")
+	}
+	hooks := 0
+	if metadata.Mutate {
+		hooks |= HookMutate
+	}
+	if metadata.PostProcess {
+		hooks |= HookPostProcess
+	}
+
+	hub := newHub(metadata, funcIdx)
+	for i := 0; i < *flagProcs; i++ {
+		s := &Slave{
+			id:      i,
+			hub:     hub,
+			mutator: newMutator(),
+			hooks:   hooks,
+		}
+		s.coverBin = newTestBinary(coverBin, funcIdx, s.periodicCheck, &s.stats)
+		s.sonarBin = newTestBinary(sonarBin, funcIdx, s.periodicCheck, &s.stats)
+		if checkedBin != "" {
+			s.checkedBin = newCheckedTestBinary(checkedBin, funcIdx, s.periodicCheck, &s.stats)
+			s.checkedPos = i
+		}
+		go s.loop()
+	}
+}
+
+// unpackBinary extracts test binaries from the archive produced by go-fuzz-build
+// into temp files and returns their names along with the metadata.
+// checkedBin is empty if the archive was built without checked binary.
+// The caller is responsible for removing the files.
+func unpackBinary(bin string) (coverBin, sonarBin, checkedBin string, metadata MetaData) {
+	zipr, err := zip.OpenReader(bin)
 	if err != nil {
 		log.Fatalf("failed to open bin file: %v", err)
 	}
-	var coverBin, sonarBin string
-	var metadata MetaData
 	for _, zipf := range zipr.File {
 		r, err := zipf.Open()
 		if err != nil {
@@ -102,6 +170,8 @@ func slaveMain() {
 				coverBin = f.Name()
 			case "sonar.exe":
 				sonarBin = f.Name()
+			case "checked.exe":
+				checkedBin = f.Name()
 			default:
 				log.Fatalf("unknown file '%v' in input archive", f.Name())
 			}
@@ -112,23 +182,29 @@ func slaveMain() {
 	if coverBin == "" || sonarBin == "" || len(metadata.Blocks) == 0 {
 		log.Fatalf("bad input archive: missing file")
 	}
+	setCoverSize(metadata)
+	return
+}
 
-	shutdownCleanup = append(shutdownCleanup, func() {
-		os.Remove(coverBin)
-		os.Remove(sonarBin)
-	})
-
-	hub := newHub(metadata)
-	for i := 0; i < *flagProcs; i++ {
-		s := &Slave{
-			id:      i,
-			hub:     hub,
-			mutator: newMutator(),
+// selectFuzzFunc returns index of the fuzz function requested with -func.
+func selectFuzzFunc(funcs []string) int {
+	if len(funcs) == 0 {
+		// Binary built by an old go-fuzz-build.
+		return 0
+	}
+	if *flagFunc == "" {
+		if len(funcs) > 1 {
+			log.Fatalf("the binary contains several fuzz functions, choose one with -func: %v", strings.Join(funcs, ", "))
+		}
+		return 0
+	}
+	for i, f := range funcs {
+		if f == *flagFunc {
+			return i
 		}
-		s.coverBin = newTestBinary(coverBin, s.periodicCheck, &s.stats)
-		s.sonarBin = newTestBinary(sonarBin, s.periodicCheck, &s.stats)
-		go s.loop()
 	}
+	log.Fatalf("the binary does not contain function %v, available functions: %v", *flagFunc, strings.Join(funcs, ", "))
+	return 0
 }
 
 func (s *Slave) loop() {
@@ -145,6 +221,17 @@ func (s *Slave) loop() {
 			s.processCrasher(crash)
 			continue
 		}
+		if len(s.slowQueue) > 0 {
+			n := len(s.slowQueue) - 1
+			slow := s.slowQueue[n]
+			s.slowQueue[n] = NewSlowArgs{}
+			s.slowQueue = s.slowQueue[:n]
+			if *flagV >= 2 {
+				log.Printf("slave %v processes slow input [%v]%v %v", s.id, len(slow.Data), hash(slow.Data), time.Duration(slow.Ns))
+			}
+			s.processSlow(slow)
+			continue
+		}
 
 		select {
 		case input := <-s.hub.triageC:
@@ -190,12 +277,35 @@ func (s *Slave) loop() {
 			continue
 		}
 
-		// 9 out of 10 iterations are random fuzzing.
+		if s.checkedBin != nil && time.Now().After(s.checkedNext) {
+			s.testChecked(ro)
+			continue
+		}
+
+		if s.hooks != 0 && s.mutator.r.Float64() < *flagHooks {
+			s.testInputHooks(ro)
+			continue
+		}
+
+		// 9 out of 10 iterations are random fuzzing
+		// (8 out of 10 if there is a grammar).
 		iter++
+		if ro.grammar != nil && iter%10 == 5 {
+			s.testInputGrammar(ro)
+			continue
+		}
 		if iter%10 != 0 || ro.verse == nil {
-			data, depth := s.mutator.generate(ro)
 			// Every 1000-th iteration goes to sonar.
 			fuzzSonarIter++
+			if *flagInProcess && fuzzSonarIter%2 != 0 {
+				// The testee does mutations itself. Its mutator is much simpler
+				// (no literals, dictionaries, typed arguments and splicing),
+				// so every other iteration is done with the normal mutator.
+				input := s.mutator.chooseInput(ro)
+				s.testInputInProcess(input.data, input.depth+1)
+				continue
+			}
+			data, depth := s.mutator.generate(ro)
 			if *flagSonar && fuzzSonarIter%1000 == 0 {
 				// TODO: ensure that generated hint inputs does not actually take 99% of time.
 				sonar := s.testInputSonar(data, depth)
@@ -247,7 +357,7 @@ func (s *Slave) triageInput(input MasterInput) {
 			return
 		}
 		if inp.cover == nil {
-			inp.cover = make([]byte, CoverSize)
+			inp.cover = make([]byte, coverRegionSize)
 			copy(inp.cover, cover)
 		} else {
 			for i, v := range cover {
@@ -274,7 +384,7 @@ func (s *Slave) triageInput(input MasterInput) {
 		if !ok {
 			return // covered by somebody else
 		}
-		inp.data = s.minimizeInput(inp.data, false, func(candidate, cover, output []byte, res int, crashed, hanged bool) bool {
+		inp.data = s.minimizeInput(s.coverBin, inp.data, false, func(candidate, cover, output []byte, res int, ns uint64, crashed, hanged bool) bool {
 			if crashed {
 				s.noteCrasher(candidate, output, hanged)
 				return false
@@ -299,9 +409,30 @@ func (s *Slave) triageInput(input MasterInput) {
 
 // processCrasher minimizes new crashers and sends them to the hub.
 func (s *Slave) processCrasher(crash NewCrasherArgs) {
+	bin := s.coverBin
+	if crash.Checked {
+		bin = s.checkedBin
+	}
+	if crash.OOM {
+		// Memory consumption depends on input size rather than on exact stack,
+		// so we accept any candidate that still exceeds the memory limit.
+		crash.Data = s.minimizeInput(bin, crash.Data, true, func(candidate, cover, output []byte, res int, ns uint64, crashed, hanged bool) bool {
+			if !crashed || hanged || !isOOM(output) {
+				if crashed {
+					s.noteCrasher(candidate, output, hanged)
+				}
+				return false
+			}
+			crash.Error = output
+			crash.Suppression = extractSuppression(output)
+			return true
+		})
+		s.hub.newCrasherC <- crash
+		return
+	}
 	// Hanging inputs can take very long time to minimize.
 	if !crash.Hanging {
-		crash.Data = s.minimizeInput(crash.Data, true, func(candidate, cover, output []byte, res int, crashed, hanged bool) bool {
+		crash.Data = s.minimizeInput(bin, crash.Data, true, func(candidate, cover, output []byte, res int, ns uint64, crashed, hanged bool) bool {
 			if !crashed {
 				return false
 			}
@@ -317,9 +448,50 @@ func (s *Slave) processCrasher(crash NewCrasherArgs) {
 	s.hub.newCrasherC <- crash
 }
 
+// processSlow confirms that the input is consistently slow,
+// minimizes it preserving slowness and sends it to the hub.
+func (s *Slave) processSlow(slow NewSlowArgs) {
+	threshold := s.slowThreshold()
+	// A single slow execution can be caused by machine overload.
+	for i := 0; i < 2; i++ {
+		s.execs[execMinimizeInput]++
+		_, ns, _, _, output, crashed, hanged := s.coverBin.test(slow.Data)
+		if crashed {
+			s.noteCrasher(slow.Data, output, hanged)
+			return
+		}
+		if ns < threshold {
+			return
+		}
+		if slow.Ns > ns {
+			slow.Ns = ns
+		}
+	}
+	minSig := slow.Sigs[0]
+	slow.Data = s.minimizeInput(s.coverBin, slow.Data, false, func(candidate, cover, output []byte, res int, ns uint64, crashed, hanged bool) bool {
+		if crashed {
+			s.noteCrasher(candidate, output, hanged)
+			return false
+		}
+		if ns < threshold {
+			return false
+		}
+		slow.Ns = ns
+		minSig = slowSig(cover)
+		return true
+	})
+	if minSig != slow.Sigs[0] {
+		slow.Sigs = append(slow.Sigs, minSig)
+	}
+	slow.Threshold = threshold
+	slow.AvgNs = atomic.LoadUint64(&s.hub.avgExecTime)
+	s.hub.newSlowC <- slow
+}
+
 // minimizeInput applies series of minimizing transformations to data
 // and asks pred whether the input is equivalent to the original one or not.
-func (s *Slave) minimizeInput(data []byte, canonicalize bool, pred func(candidate, cover, output []byte, result int, crashed, hanged bool) bool) []byte {
+// Candidates are executed with bin.
+func (s *Slave) minimizeInput(bin *TestBinary, data []byte, canonicalize bool, pred func(candidate, cover, output []byte, result int, ns uint64, crashed, hanged bool) bool) []byte {
 	res := make([]byte, len(data))
 	copy(res, data)
 	start := time.Now()
@@ -336,8 +508,8 @@ func (s *Slave) minimizeInput(data []byte, canonicalize bool, pred func(candidat
 			}
 			candidate := res[:len(res)-n]
 			*stat++
-			result, _, cover, _, output, crashed, hanged := s.coverBin.test(candidate)
-			if !pred(candidate, cover, output, result, crashed, hanged) {
+			result, ns, cover, _, output, crashed, hanged := bin.test(candidate)
+			if !pred(candidate, cover, output, result, ns, crashed, hanged) {
 				break
 			}
 			res = candidate
@@ -354,8 +526,8 @@ func (s *Slave) minimizeInput(data []byte, canonicalize bool, pred func(candidat
 		copy(candidate[:i], res[:i])
 		copy(candidate[i:], res[i+1:])
 		*stat++
-		result, _, cover, _, output, crashed, hanged := s.coverBin.test(candidate)
-		if !pred(candidate, cover, output, result, crashed, hanged) {
+		result, ns, cover, _, output, crashed, hanged := bin.test(candidate)
+		if !pred(candidate, cover, output, result, ns, crashed, hanged) {
 			continue
 		}
 		res = makeCopy(candidate)
@@ -372,8 +544,8 @@ func (s *Slave) minimizeInput(data []byte, canonicalize bool, pred func(candidat
 			candidate := tmp[:len(res)-j+i]
 			copy(candidate[i:], res[j:])
 			*stat++
-			result, _, cover, _, output, crashed, hanged := s.coverBin.test(candidate)
-			if !pred(candidate, cover, output, result, crashed, hanged) {
+			result, ns, cover, _, output, crashed, hanged := bin.test(candidate)
+			if !pred(candidate, cover, output, result, ns, crashed, hanged) {
 				continue
 			}
 			res = makeCopy(candidate)
@@ -394,8 +566,8 @@ func (s *Slave) minimizeInput(data []byte, canonicalize bool, pred func(candidat
 			copy(candidate, res)
 			candidate[i] = '0'
 			*stat++
-			result, _, cover, _, output, crashed, hanged := s.coverBin.test(candidate)
-			if !pred(candidate, cover, output, result, crashed, hanged) {
+			result, ns, cover, _, output, crashed, hanged := bin.test(candidate)
+			if !pred(candidate, cover, output, result, ns, crashed, hanged) {
 				continue
 			}
 			res = makeCopy(candidate)
@@ -552,10 +724,78 @@ func (s *Slave) smash(data []byte, depth int) {
 	}
 }
 
+// testChecked re-executes the next corpus input with the checked binary.
+// The checked binary is much slower (e.g. race detector), so it gets
+// about 10% of time. Races are non-deterministic, so the corpus is
+// re-executed in round-robin fashion all the time.
+func (s *Slave) testChecked(ro *ROData) {
+	inp := ro.corpus[s.checkedPos%len(ro.corpus)]
+	s.checkedPos++
+	start := time.Now()
+	s.execs[execChecked]++
+	_, _, _, _, output, crashed, hanged := s.checkedBin.test(inp.data)
+	s.checkedNext = time.Now().Add(9 * time.Since(start))
+	if crashed {
+		n := len(s.crasherQueue)
+		s.noteCrasher(inp.data, output, hanged)
+		if len(s.crasherQueue) > n {
+			s.crasherQueue[n].Checked = true
+		}
+	}
+}
+
 func (s *Slave) testInput(data []byte, depth, typ int) {
 	s.testInputImpl(s.coverBin, data, depth, typ)
 }
 
+// testInputInProcess does a batch of in-process fuzzing of data.
+// Crashers are re-executed out-of-process to obtain the crash output,
+// in particular this is required for panics recovered by the testee.
+func (s *Slave) testInputInProcess(data []byte, depth int) {
+	maxCover := s.hub.maxCover.Load().([]byte)
+	res, input, cover, status, execs, crashed := s.coverBin.testInProcess(data, maxCover, inProcessIters)
+	s.execs[execFuzz] += execs
+	if crashed || status == InProcPanic || status == InProcOOM {
+		s.testInput(input, depth, execFuzz)
+		return
+	}
+	if status == InProcNewCover {
+		s.noteNewInput(input, cover, res, depth, execFuzz)
+	}
+}
+
+// testInputHooks mutates a corpus input with FuzzMutate hook of the test binary
+// (or with the built-in mutator if there is no FuzzMutate), post-processes
+// the result with FuzzPostProcess hook (if any) and tests it.
+func (s *Slave) testInputHooks(ro *ROData) {
+	input := s.mutator.chooseInput(ro)
+	data := input.data
+	if s.hooks&HookMutate == 0 {
+		data = s.mutator.mutate(data, ro)
+	}
+	data, ok := s.coverBin.runHooks(data, s.hooks, s.mutator.r.Int63())
+	if !ok {
+		return
+	}
+	s.testInput(data, input.depth+1, execCustom)
+}
+
+// testInputGrammar tests an input generated from the grammar, or a mutant
+// of derivation tree of a corpus input (with parts of another corpus input).
+func (s *Slave) testInputGrammar(ro *ROData) {
+	var t *grammar.Tree
+	if n := len(ro.trees); n == 0 || s.mutator.rand(10) == 0 {
+		t = ro.grammar.Generate(s.mutator.r)
+	} else {
+		t = ro.grammar.Mutate(s.mutator.r, ro.trees[s.mutator.rand(n)], ro.trees[s.mutator.rand(n)])
+	}
+	data := t.Bytes()
+	if len(data) > MaxInputSize {
+		data = data[:MaxInputSize]
+	}
+	s.testInput(data, 0, execGrammar)
+}
+
 func (s *Slave) testInputSonar(data []byte, depth int) (sonar []byte) {
 	return s.testInputImpl(s.sonarBin, data, depth, execSonar)
 }
@@ -568,11 +808,25 @@ func (s *Slave) testInputImpl(bin *TestBinary, data []byte, depth, typ int) (son
 		}
 	}
 	s.execs[typ]++
-	res, _, cover, sonar, output, crashed, hanged := bin.test(data)
+	res, ns, cover, sonar, output, crashed, hanged := bin.test(data)
 	if crashed {
 		s.noteCrasher(data, output, hanged)
 		return nil
 	}
+	// Sonar instrumentation distorts execution time.
+	if bin == s.coverBin && ns > s.slowThreshold() {
+		s.noteSlow(data, cover, ns)
+	}
+	if s.hub.edgeHits != nil && s.execs[typ]%edgeHitsPeriod == 0 {
+		if s.stats.edgeHits == nil {
+			s.stats.edgeHits = make([]uint32, coverSize)
+		}
+		for i, v := range cover[:coverSize] {
+			if v != 0 {
+				s.stats.edgeHits[i]++
+			}
+		}
+	}
 	s.noteNewInput(data, cover, res, depth, typ)
 	return sonar
 }
@@ -591,6 +845,10 @@ func (s *Slave) noteCrasher(data, output []byte, hanged bool) {
 	ro := s.hub.ro.Load().(*ROData)
 	supp := extractSuppression(output)
 	if _, ok := ro.suppressions[hash(supp)]; ok {
+		if s.stats.crashHits == nil {
+			s.stats.crashHits = make(map[Sig]uint64)
+		}
+		s.stats.crashHits[hash(supp)]++
 		return
 	}
 	s.crasherQueue = append(s.crasherQueue, NewCrasherArgs{
@@ -598,9 +856,56 @@ func (s *Slave) noteCrasher(data, output []byte, hanged bool) {
 		Error:       output,
 		Suppression: supp,
 		Hanging:     hanged,
+		OOM:         !hanged && isOOM(output),
+	})
+}
+
+// noteSlow queues slow input for minimization unless an input
+// with the same coverage is already reported.
+func (s *Slave) noteSlow(data, cover []byte, ns uint64) {
+	sig := slowSig(cover)
+	ro := s.hub.ro.Load().(*ROData)
+	if _, ok := ro.slow[sig]; ok {
+		return
+	}
+	if _, ok := s.slowSeen[sig]; ok {
+		return
+	}
+	if s.slowSeen == nil {
+		s.slowSeen = make(map[Sig]struct{})
+	}
+	s.slowSeen[sig] = struct{}{}
+	s.slowQueue = append(s.slowQueue, NewSlowArgs{
+		Data: makeCopy(data),
+		Ns:   ns,
+		Sigs: []Sig{sig},
 	})
 }
 
+// slowThreshold returns execution time (in ns) above which inputs are considered slow.
+func (s *Slave) slowThreshold() uint64 {
+	if *flagSlow > 0 {
+		return uint64(*flagSlow)
+	}
+	t := 100 * atomic.LoadUint64(&s.hub.avgExecTime)
+	if t < minSlowTime {
+		t = minSlowTime
+	}
+	return t
+}
+
+// slowSig identifies slow inputs by the set of covered CoverTab entries.
+// Hit counts are ignored, because they usually grow with the slowness.
+func slowSig(cover []byte) Sig {
+	bits := make([]byte, coverSize/8)
+	for i, v := range cover[:coverSize] {
+		if v != 0 {
+			bits[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return hash(bits)
+}
+
 func (s *Slave) periodicCheck() {
 	if atomic.LoadUint32(&shutdown) != 0 {
 		s.shutdown()
@@ -614,12 +919,14 @@ func (s *Slave) periodicCheck() {
 	s.hub.syncC <- s.stats
 	s.stats.execs = 0
 	s.stats.restarts = 0
+	s.stats.crashHits = nil
+	s.stats.edgeHits = nil
 	if *flagV >= 2 {
-		log.Printf("slave %v: triageq=%v execs=%v mininp=%v mincrash=%v triage=%v fuzz=%v versifier=%v smash=%v sonar=%v hint=%v",
+		log.Printf("slave %v: triageq=%v execs=%v mininp=%v mincrash=%v triage=%v fuzz=%v versifier=%v grammar=%v smash=%v sonar=%v hint=%v custom=%v checked=%v",
 			s.id, len(s.triageQueue),
 			s.execs[execTotal], s.execs[execMinimizeInput], s.execs[execMinimizeCrasher],
-			s.execs[execTriageInput], s.execs[execFuzz], s.execs[execVersifier], s.execs[execSmash],
-			s.execs[execSonar], s.execs[execSonarHint])
+			s.execs[execTriageInput], s.execs[execFuzz], s.execs[execVersifier], s.execs[execGrammar], s.execs[execSmash],
+			s.execs[execSonar], s.execs[execSonarHint], s.execs[execCustom], s.execs[execChecked])
 	}
 }
 
@@ -627,19 +934,31 @@ func (s *Slave) periodicCheck() {
 func (s *Slave) shutdown() {
 	s.coverBin.close()
 	s.sonarBin.close()
+	if s.checkedBin != nil {
+		s.checkedBin.close()
+	}
 }
 
 func extractSuppression(out []byte) []byte {
 	var supp []byte
 	seenPanic := false
 	collect := false
+	frames := 0
 	s := bufio.NewScanner(bytes.NewReader(out))
 	for s.Scan() {
 		line := s.Text()
+		if !seenPanic && line == raceMsg {
+			return extractRaceSuppression(s)
+		}
 		if !seenPanic && (strings.HasPrefix(line, "panic: ") ||
 			strings.HasPrefix(line, "fatal error: ") ||
 			strings.HasPrefix(line, "SIG") && strings.Index(line, ": ") != 0) {
 			// Start of a crash message.
+			if strings.HasPrefix(line, DiffMsg) {
+				// Differential mismatches don't have stacks,
+				// the message names the functions and the kind of mismatch.
+				return []byte(line + "\n")
+			}
 			seenPanic = true
 			supp = append(supp, line...)
 			supp = append(supp, '\n')
@@ -655,10 +974,10 @@ func extractSuppression(out []byte) []byte {
 		if collect && len(line) > 0 && (line[0] >= 'a' && line[0] <= 'z' ||
 			line[0] >= 'A' && line[0] <= 'Z') {
 			// Function name line.
-			idx := strings.LastIndex(line, "(")
-			if idx != -1 {
-				supp = append(supp, line[:idx]...)
+			if fn := normalizeFrame(line); fn != "" && (*flagCrashDepth <= 0 || frames < *flagCrashDepth) {
+				supp = append(supp, fn...)
 				supp = append(supp, '\n')
+				frames++
 			}
 		}
 		if collect && line == "" {
@@ -676,6 +995,73 @@ func extractSuppression(out []byte) []byte {
 	return supp
 }
 
+// raceMsg starts data race reports of the race detector.
+const raceMsg = "WARNING: DATA RACE"
+
+// extractRaceSuppression extracts suppression from a data race report:
+// function names of stacks of both conflicting accesses.
+// Goroutine creation stacks are not included.
+func extractRaceSuppression(s *bufio.Scanner) []byte {
+	supp := []byte(raceMsg + "\n")
+	frames := 0
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "Goroutine ") || strings.HasPrefix(line, "==========") {
+			break
+		}
+		if line == "" {
+			frames = 0 // end of one of the access stacks
+			continue
+		}
+		// Function name lines are indented by 2 spaces, file:line lines by more.
+		if !strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "   ") {
+			continue
+		}
+		if fn := normalizeFrame(line[2:]); fn != "" && (*flagCrashDepth <= 0 || frames < *flagCrashDepth) {
+			supp = append(supp, fn...)
+			supp = append(supp, '\n')
+			frames++
+		}
+	}
+	return supp
+}
+
+// normalizeFrame strips arguments and generic instantiations from a function line
+// of a traceback, so that the same crash in different builds has the same suppression.
+// Inlined frames are printed with "(...)" arguments, they are normalized
+// in the same way, so that the suppression does not depend on inlining.
+func normalizeFrame(line string) string {
+	idx := strings.LastIndex(line, "(")
+	if idx == -1 {
+		return ""
+	}
+	var fn []byte
+	depth := 0
+	for _, c := range []byte(line[:idx]) {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			fn = append(fn, c)
+		}
+	}
+	return string(fn)
+}
+
+// isOOM says if output is produced by an input that exceeds memory limit.
+func isOOM(output []byte) bool {
+	return bytes.Contains(output, []byte(MemLimitMsg))
+}
+
+func (inp *Input) picks() uint64 {
+	if inp.picked == nil {
+		return 0
+	}
+	return atomic.LoadUint64(inp.picked)
+}
+
 func reverse(data []byte) []byte {
 	tmp := make([]byte, len(data))
 	for i, v := range data {
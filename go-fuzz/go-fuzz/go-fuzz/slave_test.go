@@ -0,0 +1,161 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestExtractRaceSuppression(t *testing.T) {
+	// Data race report of a race-enabled testee, followed by goroutine creation stacks.
+	output := `some output of the fuzz function
+==================
+WARNING: DATA RACE
+Read at 0x00c000018178 by goroutine 7:
+  example.com/pkg.(*counter).inc()
+      /src/pkg/pkg.go:7 +0x28
+  example.com/pkg.Fuzz.func1()
+      /src/pkg/pkg.go:13 +0x33
+
+Previous write at 0x00c000018178 by goroutine 6:
+  example.com/pkg.(*counter).inc()
+      /src/pkg/pkg.go:7 +0x3a
+  example.com/pkg.process[go.shape.int]()
+      /src/pkg/pkg.go:20 +0x44
+  example.com/pkg.Fuzz()
+      /src/pkg/pkg.go:16 +0x104
+  go-fuzz-dep.Main.func1()
+      /tmp/go-fuzz-build/src/go-fuzz-dep/main.go:36 +0x9c
+
+Goroutine 7 (running) created at:
+  example.com/pkg.startWorker()
+      /src/pkg/pkg.go:12 +0xf9
+  example.com/pkg.Fuzz()
+      /src/pkg/pkg.go:15 +0x9d
+
+Goroutine 6 (running) created at:
+  go-fuzz-dep.Main()
+      /tmp/go-fuzz-build/src/go-fuzz-dep/main.go:30 +0x2f8
+==================
+Found 1 data race(s)
+exit status 66
+`
+	want := `WARNING: DATA RACE
+example.com/pkg.(*counter).inc
+example.com/pkg.Fuzz.func1
+example.com/pkg.(*counter).inc
+example.com/pkg.process
+example.com/pkg.Fuzz
+go-fuzz-dep.Main.func1
+`
+	if got := string(extractSuppression([]byte(output))); got != want {
+		t.Fatalf("bad suppression:\n%s\nwant:\n%s", got, want)
+	}
+
+	// -crashdepth limits frames of every access stack.
+	defer func(v int) { *flagCrashDepth = v }(*flagCrashDepth)
+	*flagCrashDepth = 1
+	want = `WARNING: DATA RACE
+example.com/pkg.(*counter).inc
+example.com/pkg.(*counter).inc
+`
+	if got := string(extractSuppression([]byte(output))); got != want {
+		t.Fatalf("bad suppression with -crashdepth=1:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNormalizeFrame(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"main.Fuzz({0x48904f?, 0x1dfe95426000?, 0x1dfe953c41e0?})", "main.Fuzz"},
+		{"main.main()", "main.main"},
+		// Receivers.
+		{"main.(*T).get(0x1dfe9540ce70, {0x1dfe9540ce50, 0x3})", "main.(*T).get"},
+		{"example.com/pkg.T.String(...)", "example.com/pkg.T.String"},
+		{"example.com/pkg.T.String({0x1, 0x2})", "example.com/pkg.T.String"},
+		// Closures.
+		{"main.Fuzz.func1()", "main.Fuzz.func1"},
+		{"main.Fuzz.func1.2(0x0)", "main.Fuzz.func1.2"},
+		{"main.Fuzz.deferwrap1()", "main.Fuzz.deferwrap1"},
+		// Generics.
+		{"main.at[...]({0x1dfe9540ce20?, 0x467c0b?, 0x41e0a5?}, 0x7faf45a47108?)", "main.at"},
+		{"main.at[go.shape.int](0x1)", "main.at"},
+		{"main.(*List[...]).Push(0xc000010000, {0x1})", "main.(*List).Push"},
+		{"main.Map[go.shape.[]int,go.shape.map[string]int](0x1)", "main.Map"},
+		// Inlined frames.
+		{"main.at[...](...)", "main.at"},
+		{"main.(*T).get(...)", "main.(*T).get"},
+		{"main.Fuzz.func1(...)", "main.Fuzz.func1"},
+		// Not a function line.
+		{"created by main.Fuzz in goroutine 1", ""},
+	}
+	for _, test := range tests {
+		if got := normalizeFrame(test.line); got != test.want {
+			t.Errorf("normalizeFrame(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestExtractSuppression(t *testing.T) {
+	// The same crash in builds with and without inlining
+	// must have the same suppression.
+	outputs := []string{`panic: runtime error: index out of range [5] with length 1
+
+goroutine 1 [running]:
+main.at[...]({0x1dfe9540ce20?, 0x467c0b?, 0x41e0a5?}, 0x7faf45a47108?)
+	/tmp/p/main.go:7 +0x19
+main.(*T).get(0x1dfe9540ce70, {0x1dfe9540ce50, 0x3})
+	/tmp/p/main.go:5 +0x45
+main.Fuzz.func1()
+	/tmp/p/main.go:10 +0x39
+main.Fuzz({0x48904f?, 0x1dfe95426000?, 0x1dfe953c41e0?})
+	/tmp/p/main.go:11 +0x33
+main.main()
+	/tmp/p/main.go:15 +0x25
+
+goroutine 2 [runnable]:
+main.other()
+	/tmp/p/main.go:20 +0x10
+exit status 2
+`, `panic: runtime error: index out of range [5] with length 1
+
+goroutine 1 [running]:
+main.at[...](...)
+	/tmp/p/main.go:7
+main.(*T).get(...)
+	/tmp/p/main.go:5
+main.Fuzz.func1(...)
+	/tmp/p/main.go:10
+main.Fuzz({0x48904f?, 0x1dfe95426000?, 0x1dfe953c41e0?})
+	/tmp/p/main.go:11 +0x33
+main.main()
+	/tmp/p/main.go:15 +0x2c
+exit status 2
+`}
+	defer func(v int) { *flagCrashDepth = v }(*flagCrashDepth)
+	tests := []struct {
+		depth int
+		want  string
+	}{
+		{0, "panic: runtime error: index out of range [5] with length 1\nmain.at\nmain.(*T).get\nmain.Fuzz.func1\nmain.Fuzz\nmain.main\n"},
+		{1, "panic: runtime error: index out of range [5] with length 1\nmain.at\n"},
+		{3, "panic: runtime error: index out of range [5] with length 1\nmain.at\nmain.(*T).get\nmain.Fuzz.func1\n"},
+	}
+	for _, test := range tests {
+		*flagCrashDepth = test.depth
+		for i, output := range outputs {
+			if got := string(extractSuppression([]byte(output))); got != test.want {
+				t.Errorf("-crashdepth=%v, output #%v: got suppression:\n%s\nwant:\n%s", test.depth, i, got, test.want)
+			}
+		}
+	}
+
+	// Timeouts are bucketed only by the message.
+	hang := "program hanged (timeout 10 seconds)\n\nSIGABRT: abort\nPC=0x45c1a1 m=0 sigcode=0\n\ngoroutine 1 [running]:\nmain.loop()\n"
+	if got := string(extractSuppression([]byte(hang))); got != "SIGABRT: abort\n" {
+		t.Errorf("bad hang suppression: %q", got)
+	}
+}
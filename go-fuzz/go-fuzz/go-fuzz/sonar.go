@@ -211,11 +211,16 @@ func (s *Slave) processSonarData(data, sonar []byte, depth int, smash bool) {
 					check(data, vv1[:n1], vv2[:n2])
 				}
 
-				// Ascii-encoding.
-				// TODO: try to treat the value as negative.
+				// Ascii-encoding (e.g. the value is a result of strconv.Atoi).
 				s1 := strconv.FormatUint(u1, 10)
 				s2 := strconv.FormatUint(u2, 10)
 				check(data, []byte(s1), []byte(s2))
+				if flags&SonarSigned != 0 {
+					i1, i2 := signExtend(v1), signExtend(v2)
+					if i1 < 0 || i2 < 0 {
+						check(data, []byte(strconv.FormatInt(i1, 10)), []byte(strconv.FormatInt(i2, 10)))
+					}
+				}
 			}
 			check(data, []byte(hex.EncodeToString(v1)), []byte(hex.EncodeToString(v2)))
 		}
@@ -235,6 +240,25 @@ func (s *Slave) processSonarData(data, sonar []byte, depth int, smash bool) {
 
 var dumpMu sync.Mutex
 
+// signExtend converts little-endian signed value with trimmed
+// leading 0x00/0xff bytes to int64.
+func signExtend(v []byte) int64 {
+	if len(v) == 0 || len(v) > 8 {
+		return 0
+	}
+	var u uint64
+	for i := 0; i < 8; i++ {
+		b := byte(0)
+		if i < len(v) {
+			b = v[i]
+		} else if int8(v[len(v)-1]) < 0 {
+			b = 0xff
+		}
+		u |= uint64(b) << uint(i*8)
+	}
+	return int64(u)
+}
+
 func (site *SonarSite) update(sam SonarSample, smash, resb bool) (updated, skip bool) {
 	res := 0
 	if resb {
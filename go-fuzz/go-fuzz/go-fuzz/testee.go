@@ -10,6 +10,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -21,9 +22,7 @@ import (
 // Testee is a wrapper around one testee subprocess.
 // It manages communication with the testee, timeouts and output collection.
 type Testee struct {
-	coverRegion []byte
 	inputRegion []byte
-	sonarRegion []byte
 	cmd         *exec.Cmd
 	inPipe      *os.File
 	outPipe     *os.File
@@ -38,13 +37,16 @@ type Testee struct {
 // TestBinary handles communication with and restring of testee subprocesses.
 type TestBinary struct {
 	fileName      string
+	funcIdx       int
 	commFile      string
 	comm          *Mapping
 	periodicCheck func()
+	timeout       int // hang timeout, in seconds
 
-	coverRegion []byte
-	inputRegion []byte
-	sonarRegion []byte
+	coverRegion  []byte
+	inputRegion  []byte
+	sonarRegion  []byte
+	inprocRegion []byte
 
 	testee *Testee
 
@@ -58,26 +60,43 @@ func init() {
 	}
 }
 
-func newTestBinary(fileName string, periodicCheck func(), stats *Stats) *TestBinary {
+func newTestBinary(fileName string, funcIdx int, periodicCheck func(), stats *Stats) *TestBinary {
 	comm, err := ioutil.TempFile("", "go-fuzz-comm")
 	if err != nil {
 		log.Fatalf("failed to create comm file: %v", err)
 	}
-	comm.Truncate(CoverSize + MaxInputSize + SonarRegionSize)
+	// Same layout as CommSize, but for the actual coverage table size.
+	commSize := coverRegionSize + MaxInputSize + SonarRegionSize + coverRegionSize + 8
+	comm.Truncate(int64(commSize))
 	comm.Close()
-	mapping, mem := createMapping(comm.Name(), CoverSize+MaxInputSize+SonarRegionSize)
+	mapping, mem := createMapping(comm.Name(), commSize)
 	return &TestBinary{
 		fileName:      fileName,
+		funcIdx:       funcIdx,
 		commFile:      comm.Name(),
 		comm:          mapping,
 		periodicCheck: periodicCheck,
-		coverRegion:   mem[:CoverSize],
-		inputRegion:   mem[CoverSize : CoverSize+SonarRegionSize],
-		sonarRegion:   mem[CoverSize+SonarRegionSize:],
+		timeout:       *flagTimeout,
+		coverRegion:   mem[:coverRegionSize],
+		inputRegion:   mem[coverRegionSize : coverRegionSize+MaxInputSize],
+		sonarRegion:   mem[coverRegionSize+MaxInputSize : coverRegionSize+MaxInputSize+SonarRegionSize],
+		inprocRegion:  mem[coverRegionSize+MaxInputSize+SonarRegionSize:],
 		stats:         stats,
 	}
 }
 
+// checkedSlowdown is how much slower checked binaries (e.g. with race detector)
+// can be than the normal binary. Their hang timeout is scaled accordingly,
+// otherwise slow but finite executions are reported as hangs.
+const checkedSlowdown = 10
+
+// newCheckedTestBinary is newTestBinary for the checked binary.
+func newCheckedTestBinary(fileName string, funcIdx int, periodicCheck func(), stats *Stats) *TestBinary {
+	bin := newTestBinary(fileName, funcIdx, periodicCheck, stats)
+	bin.timeout *= checkedSlowdown
+	return bin
+}
+
 func (bin *TestBinary) close() {
 	if bin.testee != nil {
 		bin.testee.shutdown()
@@ -99,10 +118,11 @@ func (bin *TestBinary) test(data []byte) (res int, ns uint64, cover, sonar, outp
 		bin.stats.execs++
 		if bin.testee == nil {
 			bin.stats.restarts++
-			bin.testee = newTestee(bin.fileName, bin.comm, bin.coverRegion, bin.inputRegion, bin.sonarRegion)
+			bin.testee = newTestee(bin.fileName, bin.funcIdx, bin.comm, bin.inputRegion, bin.timeout)
 		}
+		var r TesteeReply
 		var retry bool
-		res, ns, cover, sonar, crashed, hanged, retry = bin.testee.test(data)
+		r, crashed, hanged, retry = bin.testee.test(data, 0, 0, 0)
 		if retry {
 			bin.testee.shutdown()
 			bin.testee = nil
@@ -111,17 +131,101 @@ func (bin *TestBinary) test(data []byte) (res int, ns uint64, cover, sonar, outp
 		if crashed {
 			output = bin.testee.shutdown()
 			if hanged {
-				hdr := fmt.Sprintf("program hanged (timeout %v seconds)\n\n", *flagTimeout)
+				hdr := fmt.Sprintf("program hanged (timeout %v seconds)\n\n", bin.timeout)
 				output = append([]byte(hdr), output...)
 			}
 			bin.testee = nil
 			return
 		}
+		res = int(r.Res)
+		ns = r.Ns
+		cover = bin.coverRegion
+		sonar = bin.sonarRegion[:r.Sonar]
 		return
 	}
 }
 
-func newTestee(bin string, comm *Mapping, coverRegion, inputRegion, sonarRegion []byte) *Testee {
+// testInProcess asks the testee to mutate and execute data iters times
+// without a round trip per input. The batch stops on the first input
+// that gives new coverage relative to maxCover or panics, this input is returned.
+// If the testee crashes or hangs, the returned input is the one it was executing.
+func (bin *TestBinary) testInProcess(data, maxCover []byte, iters int) (res int, input, cover []byte, status int, execs uint64, crashed bool) {
+	if len(data) > MaxInputSize {
+		panic("input is too large")
+	}
+	for {
+		bin.periodicCheck()
+
+		if bin.testee == nil {
+			bin.stats.restarts++
+			bin.testee = newTestee(bin.fileName, bin.funcIdx, bin.comm, bin.inputRegion, bin.timeout)
+		}
+		copy(bin.inprocRegion[:coverRegionSize], maxCover)
+		r, crashed1, _, retry := bin.testee.test(data, iters, 0, 0)
+		if retry {
+			bin.testee.shutdown()
+			bin.testee = nil
+			continue
+		}
+		if crashed1 {
+			n := binary.LittleEndian.Uint64(bin.inprocRegion[coverRegionSize:])
+			if n > MaxInputSize {
+				n = uint64(len(data))
+				copy(bin.inputRegion, data)
+			}
+			input = makeCopy(bin.inputRegion[:n])
+			bin.testee.shutdown()
+			bin.testee = nil
+			bin.stats.execs++
+			return 0, input, nil, InProcNone, 1, true
+		}
+		bin.stats.execs += r.Execs
+		if r.Status != InProcNone {
+			input = makeCopy(bin.inputRegion[:r.Len])
+			cover = bin.coverRegion
+		}
+		return int(r.Res), input, cover, int(r.Status), r.Execs, false
+	}
+}
+
+// runHooks asks the testee to apply FuzzMutate/FuzzPostProcess hooks (Hook* flags)
+// to data and returns the result. ok is false if a hook panics or crashes the testee.
+func (bin *TestBinary) runHooks(data []byte, hooks int, seed int64) (res []byte, ok bool) {
+	if len(data) > MaxInputSize {
+		panic("input is too large")
+	}
+	for {
+		bin.periodicCheck()
+
+		if bin.testee == nil {
+			bin.stats.restarts++
+			bin.testee = newTestee(bin.fileName, bin.funcIdx, bin.comm, bin.inputRegion, bin.timeout)
+		}
+		r, crashed, _, retry := bin.testee.test(data, 0, hooks, seed)
+		if retry {
+			bin.testee.shutdown()
+			bin.testee = nil
+			continue
+		}
+		if crashed {
+			output := bin.testee.shutdown()
+			bin.testee = nil
+			if *flagV >= 1 {
+				log.Printf("testee crashed in hooks: %s", output)
+			}
+			return nil, false
+		}
+		if r.Status == InProcPanic {
+			if *flagV >= 1 {
+				log.Printf("FuzzMutate or FuzzPostProcess hook panicked")
+			}
+			return nil, false
+		}
+		return makeCopy(bin.inputRegion[:r.Len]), true
+	}
+}
+
+func newTestee(bin string, funcIdx int, comm *Mapping, inputRegion []byte, timeoutSec int) *Testee {
 retry:
 	rIn, wIn, err := os.Pipe()
 	if err != nil {
@@ -146,6 +250,12 @@ retry:
 	}
 	cmd.Env = append([]string{}, os.Environ()...)
 	cmd.Env = append(cmd.Env, "GOTRACEBACK=1")
+	cmd.Env = append(cmd.Env, fmt.Sprintf("GO_FUZZ_FUNC=%v", funcIdx))
+	if *flagMemLimit != 0 {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GO_FUZZ_MEMLIMIT=%v", uint64(*flagMemLimit)<<20))
+	}
+	// Testee never exits, so race reports must crash it (no effect without race detector).
+	cmd.Env = append(cmd.Env, "GORACE="+strings.TrimSpace(os.Getenv("GORACE")+" halt_on_error=1"))
 	setupCommMapping(cmd, comm, rOut, wIn)
 	if err = cmd.Start(); err != nil {
 		// This can be a transient failure like "cannot allocate memory" or "text file is busy".
@@ -163,9 +273,7 @@ retry:
 	wIn.Close()
 	wStdout.Close()
 	t := &Testee{
-		coverRegion: coverRegion,
 		inputRegion: inputRegion,
-		sonarRegion: sonarRegion,
 		cmd:         cmd,
 		inPipe:      rIn,
 		outPipe:     wOut,
@@ -209,7 +317,7 @@ retry:
 	}()
 	// Hang watcher goroutine.
 	go func() {
-		timeout := time.Duration(*flagTimeout) * time.Second
+		timeout := time.Duration(timeoutSec) * time.Second
 		ticker := time.NewTicker(timeout / 2)
 		for {
 			select {
@@ -241,15 +349,31 @@ retry:
 	return t
 }
 
+// TesteeReply is the reply of the testee to a test request.
+type TesteeReply struct {
+	Res    uint64
+	Ns     uint64
+	Sonar  uint64
+	Execs  uint64 // number of executed inputs (more than 1 for in-process fuzzing)
+	Status uint64 // InProc* status of in-process fuzzing
+	Len    uint64 // length of the resulting input
+}
+
 // test passes data for testing.
-func (t *Testee) test(data []byte) (res int, ns uint64, cover, sonar []byte, crashed, hanged, retry bool) {
+// If iters is not 0, the testee does in-process fuzzing of data.
+// If hooks is not 0, the testee applies the hooks to data instead (seed is passed to FuzzMutate).
+func (t *Testee) test(data []byte, iters, hooks int, seed int64) (r TesteeReply, crashed, hanged, retry bool) {
 	if t.down {
 		log.Fatalf("cannot test: testee is already shutdown")
 	}
 
 	// The test binary can accumulate significant amount of memory,
 	// so we recreate it periodically.
-	t.execs++
+	if iters == 0 {
+		t.execs++
+	} else {
+		t.execs += iters
+	}
 	if t.execs > 10000 {
 		t.cmd.Process.Signal(syscall.SIGKILL)
 		retry = true
@@ -258,7 +382,8 @@ func (t *Testee) test(data []byte) (res int, ns uint64, cover, sonar []byte, cra
 
 	copy(t.inputRegion[:], data)
 	atomic.StoreInt64(&t.startTime, time.Now().UnixNano())
-	if err := binary.Write(t.outPipe, binary.LittleEndian, uint64(len(data))); err != nil {
+	req := [4]uint64{uint64(len(data)), uint64(iters), uint64(hooks), uint64(seed)}
+	if err := binary.Write(t.outPipe, binary.LittleEndian, req); err != nil {
 		if *flagV >= 1 {
 			log.Printf("write to testee failed: %v", err)
 		}
@@ -267,12 +392,6 @@ func (t *Testee) test(data []byte) (res int, ns uint64, cover, sonar []byte, cra
 	}
 	// Once we do the write, the test is running.
 	// Once we read the reply below, the test is done.
-	type Reply struct {
-		Res   uint64
-		Ns    uint64
-		Sonar uint64
-	}
-	var r Reply
 	err := binary.Read(t.inPipe, binary.LittleEndian, &r)
 	hanged = atomic.LoadInt64(&t.startTime) == -1
 	atomic.StoreInt64(&t.startTime, 0)
@@ -281,10 +400,6 @@ func (t *Testee) test(data []byte) (res int, ns uint64, cover, sonar []byte, cra
 		crashed = true
 		return
 	}
-	res = int(r.Res)
-	ns = r.Ns
-	cover = t.coverRegion
-	sonar = t.sonarRegion[:r.Sonar]
 	return
 }
 
@@ -0,0 +1,364 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"math"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+// TypedArgs describes arguments of a structure-aware fuzz function.
+// Inputs of such functions are encoded arguments (see go-fuzz-defs for the encoding),
+// TypedArgs allows to decode inputs into values, mutate individual values and encode them back.
+type TypedArgs struct {
+	types []TypeDesc
+	args  []int // indices into types
+}
+
+// TypedValue is a decoded argument (or a part of it).
+type TypedValue struct {
+	num   uint64       // bools, integers and floats (raw bits)
+	data  []byte       // strings and []byte
+	elems []TypedValue // slice and array elements, struct fields, map keys and values (interleaved), pointer element (none for nil)
+}
+
+type typedRef struct {
+	typ int
+	v   *TypedValue
+}
+
+func newTypedArgs(metadata MetaData, fn string) *TypedArgs {
+	args := metadata.FuncArgs[fn]
+	if args == nil {
+		return nil
+	}
+	return &TypedArgs{metadata.Types, args}
+}
+
+func (a *TypedArgs) decode(data []byte) []TypedValue {
+	d := &typedDecoder{data}
+	vals := make([]TypedValue, len(a.args))
+	for i, t := range a.args {
+		vals[i] = a.decodeValue(d, t)
+	}
+	return vals
+}
+
+func (a *TypedArgs) encode(vals []TypedValue) []byte {
+	var data []byte
+	for i, t := range a.args {
+		data = a.encodeValue(data, t, &vals[i])
+	}
+	return data
+}
+
+// zero returns zero value of type t.
+func (a *TypedArgs) zero(t int) TypedValue {
+	return a.decodeValue(&typedDecoder{}, t)
+}
+
+func (a *TypedArgs) decodeValue(d *typedDecoder, t int) TypedValue {
+	var v TypedValue
+	desc := &a.types[t]
+	switch desc.Kind {
+	case TypeBool:
+		v.num = d.readUint(1) & 1
+	case TypeInt, TypeUint, TypeFloat:
+		v.num = d.readUint(desc.Size)
+	case TypeString:
+		v.data = d.readBytes()
+	case TypeSlice:
+		for n := d.readLen(); n > 0; n-- {
+			v.elems = append(v.elems, a.decodeValue(d, desc.Elem))
+		}
+	case TypeArray:
+		for i := 0; i < desc.Size; i++ {
+			v.elems = append(v.elems, a.decodeValue(d, desc.Elem))
+		}
+	case TypeMap:
+		for n := d.readLen(); n > 0; n-- {
+			v.elems = append(v.elems, a.decodeValue(d, desc.Key))
+			v.elems = append(v.elems, a.decodeValue(d, desc.Elem))
+		}
+	case TypeStruct:
+		for _, f := range desc.Fields {
+			v.elems = append(v.elems, a.decodeValue(d, f))
+		}
+	case TypePtr:
+		if d.readUint(1)&1 != 0 {
+			v.elems = append(v.elems, a.decodeValue(d, desc.Elem))
+		}
+	}
+	return v
+}
+
+func (a *TypedArgs) encodeValue(data []byte, t int, v *TypedValue) []byte {
+	desc := &a.types[t]
+	switch desc.Kind {
+	case TypeBool:
+		data = append(data, byte(v.num&1))
+	case TypeInt, TypeUint, TypeFloat:
+		for i := 0; i < desc.Size; i++ {
+			data = append(data, byte(v.num>>uint(i*8)))
+		}
+	case TypeString:
+		data = appendUvarint(data, uint64(len(v.data)))
+		data = append(data, v.data...)
+	case TypeSlice:
+		data = appendUvarint(data, uint64(len(v.elems)))
+		for i := range v.elems {
+			data = a.encodeValue(data, desc.Elem, &v.elems[i])
+		}
+	case TypeArray:
+		for i := range v.elems {
+			data = a.encodeValue(data, desc.Elem, &v.elems[i])
+		}
+	case TypeMap:
+		data = appendUvarint(data, uint64(len(v.elems)/2))
+		for i := 0; i < len(v.elems); i += 2 {
+			data = a.encodeValue(data, desc.Key, &v.elems[i])
+			data = a.encodeValue(data, desc.Elem, &v.elems[i+1])
+		}
+	case TypeStruct:
+		for i, f := range desc.Fields {
+			data = a.encodeValue(data, f, &v.elems[i])
+		}
+	case TypePtr:
+		if len(v.elems) == 0 {
+			data = append(data, 0)
+		} else {
+			data = append(data, 1)
+			data = a.encodeValue(data, desc.Elem, &v.elems[0])
+		}
+	}
+	return data
+}
+
+// collect appends v and all its subvalues to refs.
+func (a *TypedArgs) collect(refs []typedRef, t int, v *TypedValue) []typedRef {
+	refs = append(refs, typedRef{t, v})
+	desc := &a.types[t]
+	for i := range v.elems {
+		switch {
+		case desc.Kind == TypeStruct:
+			refs = a.collect(refs, desc.Fields[i], &v.elems[i])
+		case desc.Kind == TypeMap && i%2 == 0:
+			refs = a.collect(refs, desc.Key, &v.elems[i])
+		default:
+			refs = a.collect(refs, desc.Elem, &v.elems[i])
+		}
+	}
+	return refs
+}
+
+// mutateTyped decodes data into arguments, mutates some of the values and encodes them back.
+func (m *Mutator) mutateTyped(data []byte, ro *ROData) []byte {
+	args := ro.args
+	vals := args.decode(data)
+	nm := 1
+	for m.rand(2) == 0 {
+		nm++
+	}
+	// Some values can't be mutated (e.g. empty structs), so limit number of attempts.
+	for iter, try := 0, 0; iter < nm && try < 100; try++ {
+		var refs []typedRef
+		for i := range vals {
+			refs = args.collect(refs, args.args[i], &vals[i])
+		}
+		if len(refs) == 0 {
+			break
+		}
+		ref := refs[m.rand(len(refs))]
+		if m.mutateValue(ro, ref.typ, ref.v) {
+			iter++
+		}
+	}
+	res := args.encode(vals)
+	if len(res) > MaxInputSize {
+		res = res[:MaxInputSize]
+	}
+	return res
+}
+
+// mutateValue mutates a single value of type t, returns false if it wasn't able to do so.
+func (m *Mutator) mutateValue(ro *ROData, t int, v *TypedValue) bool {
+	args := ro.args
+	desc := &args.types[t]
+	switch desc.Kind {
+	case TypeBool:
+		v.num ^= 1
+	case TypeInt, TypeUint:
+		switch m.rand(5) {
+		case 0:
+			v.num += uint64(m.rand(35) + 1)
+		case 1:
+			v.num -= uint64(m.rand(35) + 1)
+		case 2:
+			v.num ^= 1 << uint(m.rand(desc.Size*8))
+		case 3:
+			bits := uint(desc.Size*8 - 1)
+			interesting := []uint64{0, 1, ^uint64(0), 1 << bits, 1<<bits - 1}
+			v.num = interesting[m.rand(len(interesting))]
+		case 4:
+			if len(ro.intLits) == 0 {
+				return false
+			}
+			v.num = 0
+			for i, b := range ro.intLits[m.rand(len(ro.intLits))] {
+				v.num |= uint64(b) << uint(i*8)
+			}
+			if m.rand(3) == 0 {
+				v.num = -v.num
+			}
+		}
+		if desc.Size < 8 {
+			v.num &= 1<<uint(desc.Size*8) - 1
+		}
+	case TypeFloat:
+		f := math.Float64frombits(v.num)
+		if desc.Size == 4 {
+			f = float64(math.Float32frombits(uint32(v.num)))
+		}
+		switch m.rand(4) {
+		case 0:
+			f += float64(m.rand(35)+1) * (m.r.Float64() - 0.5)
+		case 1:
+			f *= m.r.Float64() * 4
+		case 2:
+			interesting := []float64{0, 1, -1, 0.5, math.Inf(1), math.Inf(-1), math.NaN(), math.MaxFloat64, math.SmallestNonzeroFloat64}
+			f = interesting[m.rand(len(interesting))]
+		case 3:
+			f = -f
+		}
+		if desc.Size == 4 {
+			v.num = uint64(math.Float32bits(float32(f)))
+		} else {
+			v.num = math.Float64bits(f)
+		}
+	case TypeString:
+		if len(ro.strLits) != 0 && m.rand(4) == 0 {
+			v.data = makeCopy(ro.strLits[m.rand(len(ro.strLits))])
+		} else {
+			v.data = m.mutateBytes(v.data, ro)
+		}
+	case TypeSlice, TypeMap:
+		// Elements of maps are key/value pairs.
+		n := 1
+		if desc.Kind == TypeMap {
+			n = 2
+		}
+		cnt := len(v.elems) / n
+		switch m.rand(4) {
+		case 0:
+			// Remove an element.
+			if cnt == 0 {
+				return false
+			}
+			i := m.rand(cnt) * n
+			v.elems = append(v.elems[:i], v.elems[i+n:]...)
+		case 1:
+			// Insert a new element.
+			if cnt >= TypedMaxLen {
+				return false
+			}
+			i := m.rand(cnt+1) * n
+			var elems []TypedValue
+			if desc.Kind == TypeMap {
+				elems = append(elems, args.zero(desc.Key))
+			}
+			elems = append(elems, args.zero(desc.Elem))
+			v.elems = append(v.elems[:i], append(elems, v.elems[i:]...)...)
+		case 2:
+			// Duplicate an element.
+			if cnt == 0 || cnt >= TypedMaxLen {
+				return false
+			}
+			i := m.rand(cnt) * n
+			elems := copyValues(v.elems[i : i+n])
+			v.elems = append(v.elems[:i], append(elems, v.elems[i:]...)...)
+		case 3:
+			// Swap two elements.
+			if cnt < 2 {
+				return false
+			}
+			i, j := m.rand(cnt)*n, m.rand(cnt)*n
+			for k := 0; k < n; k++ {
+				v.elems[i+k], v.elems[j+k] = v.elems[j+k], v.elems[i+k]
+			}
+		}
+	case TypePtr:
+		if len(v.elems) == 0 {
+			v.elems = append(v.elems, args.zero(desc.Elem))
+		} else {
+			v.elems = nil
+		}
+	default:
+		// Arrays and structs are mutated element-wise.
+		return false
+	}
+	return true
+}
+
+func copyValues(vals []TypedValue) []TypedValue {
+	res := make([]TypedValue, len(vals))
+	for i, v := range vals {
+		res[i] = TypedValue{v.num, makeCopy(v.data), copyValues(v.elems)}
+	}
+	return res
+}
+
+func appendUvarint(data []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(data, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// typedDecoder mirrors go-fuzz-dep.Decoder.
+type typedDecoder struct {
+	data []byte
+}
+
+func (d *typedDecoder) readUint(size int) uint64 {
+	var v uint64
+	for i := 0; i < size && len(d.data) != 0; i++ {
+		v |= uint64(d.data[0]) << uint(i*8)
+		d.data = d.data[1:]
+	}
+	return v
+}
+
+func (d *typedDecoder) readBytes() []byte {
+	n := d.readUvarint()
+	if n > uint64(len(d.data)) {
+		n = uint64(len(d.data))
+	}
+	v := makeCopy(d.data[:n])
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *typedDecoder) readLen() int {
+	n := d.readUvarint()
+	if n > uint64(len(d.data)) {
+		n = uint64(len(d.data))
+	}
+	if n > TypedMaxLen {
+		n = TypedMaxLen
+	}
+	return int(n)
+}
+
+func (d *typedDecoder) readUvarint() uint64 {
+	var v uint64
+	for i := 0; i < 10 && len(d.data) != 0; i++ {
+		b := d.data[0]
+		d.data = d.data[1:]
+		v |= uint64(b&0x7f) << uint(i*7)
+		if b < 0x80 {
+			break
+		}
+	}
+	return v
+}
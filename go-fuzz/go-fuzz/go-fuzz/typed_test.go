@@ -0,0 +1,65 @@
+// Copyright 2015 Dmitry Vyukov. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+// Arguments of func(a int, s string, m struct{ A int16; C []Point; M map[string]uint8; P *Node }),
+// where type Node struct{ V int; Next *Node }.
+var testArgs = &TypedArgs{
+	types: []TypeDesc{
+		{Kind: TypeInt, Size: 8},
+		{Kind: TypeString},
+		{Kind: TypeStruct, Fields: []int{3, 4, 7, 9}},
+		{Kind: TypeInt, Size: 2},
+		{Kind: TypeSlice, Elem: 5},
+		{Kind: TypeStruct, Fields: []int{3, 3}},
+		{Kind: TypeUint, Size: 1},
+		{Kind: TypeMap, Key: 1, Elem: 6},
+		{Kind: TypeStruct, Fields: []int{0, 9}},
+		{Kind: TypePtr, Elem: 8},
+	},
+	args: []int{0, 1, 2},
+}
+
+func TestTypedEncode(t *testing.T) {
+	data := []byte{
+		42, 0, 0, 0, 0, 0, 0, 0, // a
+		3, 'f', 'o', 'o', // s
+		1, 2, // m.A
+		1, 3, 4, 5, 6, // m.C
+		1, 1, 'x', 7, // m.M
+		1, 9, 0, 0, 0, 0, 0, 0, 0, 0, // m.P
+	}
+	vals := testArgs.decode(data)
+	if vals[0].num != 42 || string(vals[1].data) != "foo" || vals[2].elems[0].num != 0x201 {
+		t.Fatalf("bad decoded values: %+v", vals)
+	}
+	if res := testArgs.encode(vals); !bytes.Equal(res, data) {
+		t.Fatalf("encoded data differs:\n%v\n%v", res, data)
+	}
+	// Missing data decodes as zero values.
+	if res := testArgs.encode(testArgs.decode(nil)); len(res) != 8+1+2+1+1+1 {
+		t.Fatalf("bad encoding of zero values: %v", res)
+	}
+}
+
+func TestTypedMutate(t *testing.T) {
+	m := &Mutator{r: rand.New(rand.NewSource(0))}
+	ro := &ROData{args: testArgs, corpus: []Input{{data: []byte("foo")}}}
+	data := testArgs.encode(testArgs.decode(nil))
+	for i := 0; i < 2000; i++ {
+		data = m.mutateTyped(data, ro)
+		// Mutated data must be in canonical encoding.
+		if res := testArgs.encode(testArgs.decode(data)); !bytes.Equal(res, data) && len(data) < MaxInputSize {
+			t.Fatalf("iteration %v: mutated data is not canonical:\n%v\n%v", i, data, res)
+		}
+	}
+}